@@ -1,15 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"log"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2/audio"
-	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
-	mp3decoder "github.com/hajimehoshi/go-mp3"
+	"iatearock.com/musicroll/decoder"
 )
 
 type AudioControl struct {
@@ -17,46 +13,35 @@ type AudioControl struct {
 	ctx    *audio.Context
 	player *audio.Player
 	length float64 // length of music in second
+	// play slower or faster without changing pitch, the player see the
+	// stretched sound, times outside AudioControl are of the music
+	stretch *decoder.Stretcher
+	// A-B loop, the player position keep going after a wrap, from seekFrom
+	loop         *decoder.Loop
+	loopA, loopB time.Duration
+	hasA, hasB   bool
+	seekFrom     time.Duration
+	sampleRate   int
 }
 
+// shortest loop, a shorter B is not set
+const minLoop = time.Millisecond * 100
+
 // Create a new audio control with path to a music file
 func NewAudioControl(path string) *AudioControl {
 	// ac := &AudioControl{ctx: audio.NewContext(44100), path: path}
-	var sampleRate int
-	var length float64 // length of music in second
-	var ctx *audio.Context
-	var s *mp3.Stream
-	var err error
-	if strings.HasSuffix(path, ".mp3") {
-		b, err := os.ReadFile(path)
-		if err != nil {
-			log.Println(err)
-			return nil
-		}
-		reader := bytes.NewReader(b)
-		d, err := mp3decoder.NewDecoder(reader)
-		if err != nil {
-			log.Println(err)
-			return nil
-		}
-
-		// length in second
-		// go-mp3 doc say sample always convert to 16bit, 2 channels i.e. 4 bytes
-		// TODO but is the length before the convertion?
-		length = float64(d.Length()) / float64(d.SampleRate()) / 4.0
-		sampleRate = d.SampleRate()
-
-		ctx = audio.NewContext(sampleRate)
-		s, err = mp3.DecodeWithSampleRate(ctx.SampleRate(), reader)
-		if err != nil {
-			log.Println(err)
-			return nil
-		}
+	snd, err := decoder.Open(path)
+	if err != nil {
+		log.Println(err)
+		return nil
 	}
-	ac := &AudioControl{ctx: ctx}
-	ac.player, err = ac.ctx.NewPlayer(s)
+	ac := &AudioControl{ctx: audio.NewContext(snd.SampleRate())}
+	ac.sampleRate = snd.SampleRate()
+	ac.stretch = decoder.NewStretcher(snd, snd.SampleRate())
+	ac.loop = decoder.NewLoop(ac.stretch, snd.SampleRate())
+	ac.player, err = ac.ctx.NewPlayer(decoder.NewPCMReader(ac.loop))
 	ac.path = path
-	ac.length = length
+	ac.length = snd.Length().Seconds()
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -72,8 +57,109 @@ func (ac *AudioControl) Pause() {
 	ac.player.Pause()
 }
 
+// Current position in the music, at any speed
 func (ac *AudioControl) Current() time.Duration {
-	return ac.player.Current()
+	c := time.Duration(float64(ac.player.Current()) * ac.stretch.Speed())
+	if a, b, ok := ac.Loop(); ok && ac.seekFrom < b && c >= b {
+		// played round the loop
+		c = a + (c-a)%(b-a)
+	}
+	return c
+}
+
+// Seek to position in the music
+func (ac *AudioControl) Seek(t time.Duration) {
+	ac.seekFrom = t
+	ac.player.Seek(time.Duration(float64(t) / ac.stretch.Speed()))
+}
+
+// Loop return A and B, ok is false when not looping
+func (ac *AudioControl) Loop() (a, b time.Duration, ok bool) {
+	return ac.loopA, ac.loopB, ac.hasA && ac.hasB
+}
+
+// LoopA return A, ok is false when not set
+func (ac *AudioControl) LoopA() (time.Duration, bool) {
+	return ac.loopA, ac.hasA
+}
+
+// SetLoopA set start of the loop, B is cleared when it is before A
+func (ac *AudioControl) SetLoopA(t time.Duration) {
+	c := ac.Current()
+	ac.loopA, ac.hasA = t, true
+	if ac.hasB && ac.loopB < t+minLoop {
+		ac.hasB = false
+	}
+	ac.updateLoop(c)
+}
+
+// SetLoopB set end of the loop, playing from A to B again and again, B
+// before A swap the two, B without A loop from the start
+func (ac *AudioControl) SetLoopB(t time.Duration) {
+	c := ac.Current()
+	if !ac.hasA {
+		ac.loopA, ac.hasA = 0, true
+	}
+	if t < ac.loopA {
+		ac.loopA, t = t, ac.loopA
+	}
+	if t-ac.loopA < minLoop {
+		return
+	}
+	ac.loopB, ac.hasB = t, true
+	ac.updateLoop(c)
+}
+
+// ClearLoop play to the end
+func (ac *AudioControl) ClearLoop() {
+	c := ac.Current()
+	ac.hasA, ac.hasB = false, false
+	ac.updateLoop(c)
+}
+
+// updateLoop set loop of the stretched sound, and go on from c, back to A
+// when c is past the loop
+func (ac *AudioControl) updateLoop(c time.Duration) {
+	a, b, ok := ac.Loop()
+	if ok {
+		rate := float64(ac.sampleRate) / ac.stretch.Speed()
+		ac.loop.SetLoop(int(a.Seconds()*rate), int(b.Seconds()*rate))
+		if c >= b {
+			c = a
+		}
+	} else {
+		ac.loop.ClearLoop()
+	}
+	// the player position restart from c
+	ac.Seek(c)
+}
+
+func (ac *AudioControl) Speed() float64 {
+	return ac.stretch.Speed()
+}
+
+func (ac *AudioControl) Semitones() int {
+	return ac.stretch.Semitones()
+}
+
+// SetSemitones transpose playback up or down, at the same speed
+func (ac *AudioControl) SetSemitones(semitones int) {
+	c := ac.Current()
+	if err := ac.stretch.SetSemitones(semitones); err != nil {
+		log.Println(err)
+	}
+	ac.updateLoop(c)
+}
+
+// SetSpeed play at speed, e.g. 0.5 for half speed, pitch is the same
+func (ac *AudioControl) SetSpeed(speed float64) {
+	c := ac.Current()
+	if err := ac.stretch.SetSpeed(speed); err != nil {
+		log.Println(err)
+	}
+	// loop is in samples of the stretched sound, and drop sound the player
+	// buffered at the old speed
+	ac.updateLoop(c)
 }
 
 func (ac *AudioControl) IsPlaying() bool {
@@ -96,7 +182,7 @@ func (ac *AudioControl) Forward(offset time.Duration) {
 	if c > time.Duration(ac.length*1e9) {
 		c = time.Duration(ac.length * 1e9)
 	}
-	ac.player.Seek(c)
+	ac.Seek(c)
 }
 
 // Back by offset amount of time
@@ -105,5 +191,5 @@ func (ac *AudioControl) Back(offset time.Duration) {
 	if c < time.Duration(0) {
 		c = 0
 	}
-	ac.player.Seek(c)
+	ac.Seek(c)
 }
@@ -0,0 +1,173 @@
+// Package decoder open sound files for playback and analysis. Formats are
+// registered once, and found by the first bytes of a file or its extension.
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+// bytes read from the start of a file to sniff the format
+const sniffSize = 16
+
+var ErrUnknownFormat = errors.New("file type not supported")
+
+// Codec decode one format
+type Codec struct {
+	Name       string
+	Extensions []string // with the dot, lower case
+	// Sniff is true when a file starting with head is this format
+	Sniff func(head []byte) bool
+	// Decode take ownership of f, closing the stream close f
+	Decode func(f io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   []Codec
+)
+
+// Register add a codec, later codecs are tried first, so a format can be
+// replaced
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs = append([]Codec{c}, codecs...)
+}
+
+func init() {
+	Register(Codec{
+		Name:       "mp3",
+		Extensions: []string{".mp3"},
+		Sniff: func(head []byte) bool {
+			// ID3 tag, or frame sync
+			return bytes.HasPrefix(head, []byte("ID3")) ||
+				len(head) > 1 && head[0] == 0xFF && head[1]&0xE0 == 0xE0
+		},
+		Decode: func(f io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+			return mp3.Decode(f)
+		},
+	})
+	Register(Codec{
+		Name:       "wav",
+		Extensions: []string{".wav", ".wave"},
+		Sniff: func(head []byte) bool {
+			return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE"
+		},
+		Decode: func(f io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+			return wav.Decode(f)
+		},
+	})
+	Register(Codec{
+		Name:       "vorbis",
+		Extensions: []string{".ogg", ".oga"},
+		Sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("OggS"))
+		},
+		Decode: func(f io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+			return vorbis.Decode(f)
+		},
+	})
+	Register(Codec{
+		Name:       "flac",
+		Extensions: []string{".flac"},
+		Sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("fLaC"))
+		},
+		Decode: decodeFlac,
+	})
+}
+
+// Sound is a decoded file, samples are always 2 channels, Format tell how
+// many the file has
+type Sound struct {
+	beep.StreamSeekCloser
+	Format beep.Format
+	Codec  string
+}
+
+func (s *Sound) SampleRate() int {
+	return s.Format.SampleRate.N(time.Second)
+}
+
+func (s *Sound) Channels() int {
+	return s.Format.NumChannels
+}
+
+// Length of the sound
+func (s *Sound) Length() time.Duration {
+	return s.Format.SampleRate.D(s.Len())
+}
+
+// Find return codec of a file, by its first bytes, or by its extension
+// when no codec know the bytes
+func Find(path string, head []byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, c := range codecs {
+		if c.Sniff != nil && c.Sniff(head) {
+			return c, nil
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, c := range codecs {
+		for _, e := range c.Extensions {
+			if e == ext {
+				return c, nil
+			}
+		}
+	}
+	return Codec{}, ErrUnknownFormat
+}
+
+// Supported is true when the file can be decoded
+func Supported(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = Find(path, readHead(f))
+	return err == nil
+}
+
+// Open decode a file, close the Sound when done
+func Open(path string) (*Sound, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Find(path, readHead(f))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s, format, err := c.Decode(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+	return &Sound{StreamSeekCloser: s, Format: format, Codec: c.Name}, nil
+}
+
+func readHead(r io.Reader) []byte {
+	head := make([]byte, sniffSize)
+	n, _ := io.ReadFull(r, head)
+	return head[:n]
+}
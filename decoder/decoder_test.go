@@ -0,0 +1,114 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+)
+
+// ramp from 0 to 1 on left, 0 to -1 on right
+type rampStreamer struct {
+	pos, n int
+}
+
+func (r *rampStreamer) Stream(samples [][2]float64) (int, bool) {
+	i := 0
+	for ; i < len(samples) && r.pos < r.n; i++ {
+		v := float64(r.pos) / float64(r.n)
+		samples[i] = [2]float64{v, -v}
+		r.pos++
+	}
+	return i, i > 0
+}
+
+func (r *rampStreamer) Err() error    { return nil }
+func (r *rampStreamer) Len() int      { return r.n }
+func (r *rampStreamer) Position() int { return r.pos }
+func (r *rampStreamer) Seek(p int) error {
+	r.pos = p
+	return nil
+}
+
+func writeWav(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := beep.Format{SampleRate: 8000, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(f, &rampStreamer{n: 4000}, format); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"song.wav", "SONG.WAV", "song", "wav.mp3"} {
+		path := filepath.Join(dir, name)
+		writeWav(t, path)
+		if !Supported(path) {
+			t.Errorf("%s not supported", name)
+			continue
+		}
+		snd, err := Open(path)
+		if err != nil {
+			t.Errorf("%s : %v", name, err)
+			continue
+		}
+		if snd.Codec != "wav" || snd.SampleRate() != 8000 || snd.Channels() != 2 ||
+			snd.Length() != time.Second/2 {
+			t.Errorf("%s got %s %d Hz %d channels %v", name, snd.Codec, snd.SampleRate(), snd.Channels(), snd.Length())
+		}
+		snd.Close()
+	}
+
+	text := filepath.Join(dir, "notes.txt")
+	os.WriteFile(text, []byte("not a sound"), 0644)
+	if Supported(text) {
+		t.Errorf("text file supported")
+	}
+	if _, err := Open(text); err == nil {
+		t.Errorf("open text file, want error")
+	}
+}
+
+func TestPCMReader(t *testing.T) {
+	r := NewPCMReader(&rampStreamer{n: 1000})
+	if r.Length() != 4000 {
+		t.Errorf("length got %d, want 4000", r.Length())
+	}
+	// odd size, so samples are split between reads
+	p := make([]byte, 7)
+	all := []byte{}
+	for {
+		n, err := r.Read(p)
+		all = append(all, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(all) != 4000 {
+		t.Fatalf("read %d bytes, want 4000", len(all))
+	}
+	for i := 0; i < 1000; i++ {
+		l := int16(binary.LittleEndian.Uint16(all[i*4:]))
+		r := int16(binary.LittleEndian.Uint16(all[i*4+2:]))
+		if l != toInt16(float64(i)/1000) || r != -l {
+			t.Fatalf("sample %d got %d %d", i, l, r)
+		}
+	}
+
+	pos, err := r.Seek(2002, io.SeekStart)
+	if err != nil || pos != 2000 {
+		t.Errorf("seek got %d %v, want 2000", pos, err)
+	}
+	if n, _ := r.Read(p[:4]); n != 4 || int16(binary.LittleEndian.Uint16(p)) != toInt16(0.5) {
+		t.Errorf("read after seek got %v", p[:4])
+	}
+}
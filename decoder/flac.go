@@ -0,0 +1,125 @@
+package decoder
+
+// FLAC decoder on mewkiz/flac. The one of beep keep its end of file error
+// and decoded frame after Seek, so a file played to the end is silent
+// after seeking back.
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/faiface/beep"
+	"github.com/mewkiz/flac"
+)
+
+type flacDecoder struct {
+	f      io.ReadSeekCloser
+	stream *flac.Stream
+	frame  [][2]float64 // decoded frame
+	buf    [][2]float64 // rest of frame not streamed yet
+	pos    int
+	err    error
+}
+
+func decodeFlac(f io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	stream, err := flac.NewSeek(f)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("flac: %w", err)
+	}
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(stream.Info.SampleRate),
+		NumChannels: int(stream.Info.NChannels),
+		Precision:   int(stream.Info.BitsPerSample+7) / 8,
+	}
+	return &flacDecoder{f: f, stream: stream}, format, nil
+}
+
+func (d *flacDecoder) Stream(samples [][2]float64) (int, bool) {
+	if d.err != nil {
+		return 0, false
+	}
+	n := 0
+	for n < len(samples) {
+		if len(d.buf) == 0 {
+			if err := d.refill(); err != nil {
+				// end of file is not an error, Seek can play again
+				if err != io.EOF {
+					d.err = err
+				}
+				break
+			}
+		}
+		m := copy(samples[n:], d.buf)
+		d.buf = d.buf[m:]
+		n += m
+	}
+	d.pos += n
+	return n, n > 0
+}
+
+// refill decode the next frame into buf
+func (d *flacDecoder) refill() error {
+	frame, err := d.stream.ParseNext()
+	if err != nil {
+		return err
+	}
+	left := frame.Subframes[0].Samples
+	right := left // mono on both sides
+	if len(frame.Subframes) > 1 {
+		right = frame.Subframes[1].Samples
+	}
+	q := 1 / float64(int64(1)<<(d.stream.Info.BitsPerSample-1))
+	d.frame = d.frame[:0]
+	for i := range left {
+		d.frame = append(d.frame, [2]float64{float64(left[i]) * q, float64(right[i]) * q})
+	}
+	d.buf = d.frame
+	return nil
+}
+
+func (d *flacDecoder) Err() error {
+	return d.err
+}
+
+func (d *flacDecoder) Len() int {
+	return int(d.stream.Info.NSamples)
+}
+
+func (d *flacDecoder) Position() int {
+	return d.pos
+}
+
+// Seek go to sample p, the error and frame left from before are dropped
+func (d *flacDecoder) Seek(p int) error {
+	if p < 0 || p > d.Len() {
+		return fmt.Errorf("flac: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	d.buf, d.err = nil, nil
+	// start of the frame with p, then skip to p
+	start, err := d.stream.Seek(uint64(p))
+	if err != nil {
+		d.err = err
+		return err
+	}
+	d.pos = int(start)
+	for d.pos < p {
+		if err := d.refill(); err != nil {
+			if err != io.EOF {
+				d.err = err
+				return err
+			}
+			break
+		}
+		skip := p - d.pos
+		if skip > len(d.buf) {
+			skip = len(d.buf)
+		}
+		d.buf = d.buf[skip:]
+		d.pos += skip
+	}
+	return nil
+}
+
+func (d *flacDecoder) Close() error {
+	return d.f.Close()
+}
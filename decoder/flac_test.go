@@ -0,0 +1,99 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// ramp as rampStreamer, 16 bit, in frames of 1000 samples
+func writeFlac(t *testing.T, path string, n int) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &meta.StreamInfo{
+		BlockSizeMin:  1000,
+		BlockSizeMax:  1000,
+		SampleRate:    8000,
+		NChannels:     2,
+		BitsPerSample: 16,
+	}
+	enc, err := flac.NewEncoder(f, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for start := 0; start < n; start += 1000 {
+		left, right := make([]int32, 1000), make([]int32, 1000)
+		for i := range left {
+			left[i] = int32(toInt16(float64(start+i) / float64(n)))
+			right[i] = -left[i]
+		}
+		fr := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         1000,
+				SampleRate:        8000,
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+			},
+			Subframes: []*frame.Subframe{
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: left, NSamples: 1000},
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: right, NSamples: 1000},
+			},
+		}
+		if err := enc.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlacSeek(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.flac")
+	writeFlac(t, path, 4000)
+	snd, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snd.Close()
+	if snd.Codec != "flac" || snd.Len() != 4000 {
+		t.Fatalf("got %s %d samples", snd.Codec, snd.Len())
+	}
+	readAll := func() int {
+		buf := make([][2]float64, 300)
+		total := 0
+		for {
+			n, ok := snd.Stream(buf)
+			total += n
+			if !ok {
+				return total
+			}
+		}
+	}
+
+	// to the end, back to the start, and to the end again
+	for i := 0; i < 2; i++ {
+		if err := snd.Seek(0); err != nil {
+			t.Fatal(err)
+		}
+		if n := readAll(); n != 4000 || snd.Err() != nil {
+			t.Errorf("pass %d streamed %d samples, %v", i, n, snd.Err())
+		}
+	}
+
+	// in the middle of a frame, samples are decoded by 1<<15
+	if err := snd.Seek(2500); err != nil {
+		t.Fatal(err)
+	}
+	s := make([][2]float64, 1)
+	if n, _ := snd.Stream(s); n != 1 || snd.Position() != 2501 || int16(s[0][0]*(1<<15)) != toInt16(2500./4000) {
+		t.Errorf("after seek got %v at %d", s[0], snd.Position())
+	}
+}
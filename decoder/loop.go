@@ -0,0 +1,107 @@
+package decoder
+
+// Loop a region of a streamer, when a stream reach the end of the loop it
+// go on from the start. The sound after the end is faded into the start,
+// so there is no click.
+
+import (
+	"sync"
+
+	"github.com/faiface/beep"
+)
+
+const loopFade = 0.005 // second, cross fade at the end of a loop
+
+// Loop play a streamer, repeating from a to b once it is played up to b.
+// Position, Len and Seek are of the streamer, a position past b is played
+// to the end.
+type Loop struct {
+	mu   sync.Mutex
+	s    beep.StreamSeeker
+	a, b int // no loop when b <= a
+	fade [][2]float64
+	// sound after b, faded into a
+	tail    [][2]float64
+	tailPos int
+}
+
+func NewLoop(s beep.StreamSeeker, sampleRate int) *Loop {
+	return &Loop{s: s, fade: make([][2]float64, int(loopFade*float64(sampleRate)))}
+}
+
+// SetLoop repeat from a to b, in samples of the streamer
+func (l *Loop) SetLoop(a, b int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b > l.s.Len() {
+		b = l.s.Len()
+	}
+	l.a, l.b = a, b
+}
+
+// ClearLoop play to the end
+func (l *Loop) ClearLoop() {
+	l.SetLoop(0, 0)
+}
+
+func (l *Loop) Stream(samples [][2]float64) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for n < len(samples) {
+		want := samples[n:]
+		pos := l.s.Position()
+		looping := l.b > l.a && pos < l.b
+		if looping && pos+len(want) > l.b {
+			want = want[:l.b-pos]
+		}
+		m, ok := l.s.Stream(want)
+		for i := 0; i < m && l.tailPos < len(l.tail); i++ {
+			r := float64(l.tailPos) / float64(len(l.tail))
+			t := l.tail[l.tailPos]
+			want[i] = [2]float64{want[i][0]*r + t[0]*(1-r), want[i][1]*r + t[1]*(1-r)}
+			l.tailPos++
+		}
+		n += m
+		// the end of the streamer may come a little before its Len
+		if looping && (l.s.Position() >= l.b || !ok && l.s.Position() > l.a) {
+			if err := l.wrap(); err != nil {
+				break
+			}
+			continue
+		}
+		if !ok || m == 0 {
+			break
+		}
+	}
+	return n, n > 0
+}
+
+// wrap go back to a, keeping the sound after b to fade out
+func (l *Loop) wrap() error {
+	m, _ := l.s.Stream(l.fade)
+	l.tail = l.fade[:m]
+	l.tailPos = 0
+	return l.s.Seek(l.a)
+}
+
+func (l *Loop) Err() error {
+	return l.s.Err()
+}
+
+func (l *Loop) Len() int {
+	return l.s.Len()
+}
+
+func (l *Loop) Position() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.s.Position()
+}
+
+func (l *Loop) Seek(p int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tail = l.tail[:0]
+	return l.s.Seek(p)
+}
@@ -0,0 +1,69 @@
+package decoder
+
+import "testing"
+
+func TestLoop(t *testing.T) {
+	rate := 8000
+	src := &rampStreamer{n: rate}
+	l := NewLoop(src, rate)
+	l.SetLoop(2000, 3000)
+
+	out := make([][2]float64, 5000)
+	if n, ok := l.Stream(out); n != len(out) || !ok {
+		t.Fatalf("streamed %d %v, want %d", n, ok, len(out))
+	}
+	fade := int(loopFade * float64(rate))
+	for i, s := range out {
+		// position in the source, after the fade it is the ramp again
+		want := i
+		if i >= 3000 {
+			want = 2000 + (i-3000)%1000
+		}
+		v := float64(want) / float64(rate)
+		if (i < 3000 || (i-3000)%1000 >= fade) && s[0] != v {
+			t.Fatalf("sample %d got %.4f, want %.4f", i, s[0], v)
+		}
+		// fade from after the end into the start
+		if i >= 3000 && (i-3000)%1000 < fade && (s[0] < 2000./float64(rate) || s[0] > 3000./float64(rate)+loopFade) {
+			t.Fatalf("sample %d in fade got %.4f", i, s[0])
+		}
+	}
+	if p := l.Position(); p != 2000 {
+		t.Errorf("position got %d, want 2000, back at the start", p)
+	}
+
+	// past the loop play to the end
+	l.Seek(3500)
+	n := 0
+	for {
+		m, ok := l.Stream(out)
+		n += m
+		if !ok {
+			break
+		}
+	}
+	if n != rate-3500 {
+		t.Errorf("after the loop streamed %d, want %d", n, rate-3500)
+	}
+
+	// loop to the end of the source
+	l.SetLoop(7000, rate*2)
+	l.Seek(6000)
+	if n, _ := l.Stream(out[:3000]); n != 3000 || out[2000][0] != 7000./float64(rate) {
+		t.Errorf("loop to the end streamed %d, after the end got %.4f", n, out[2000][0])
+	}
+
+	l.ClearLoop()
+	l.Seek(0)
+	n = 0
+	for {
+		m, ok := l.Stream(out)
+		n += m
+		if !ok {
+			break
+		}
+	}
+	if n != rate {
+		t.Errorf("no loop streamed %d, want %d", n, rate)
+	}
+}
@@ -0,0 +1,79 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/faiface/beep"
+)
+
+// PCMReader read a beep streamer as 16bit little endian stereo, the format
+// ebiten audio players read
+type PCMReader struct {
+	s       beep.StreamSeeker
+	samples [][2]float64
+	pending []byte // bytes of a sample not yet read
+}
+
+func NewPCMReader(s beep.StreamSeeker) *PCMReader {
+	return &PCMReader{s: s, samples: make([][2]float64, 512)}
+}
+
+func (r *PCMReader) Read(p []byte) (int, error) {
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	for n < len(p) {
+		num := (len(p) - n + 3) / 4
+		if num > len(r.samples) {
+			num = len(r.samples)
+		}
+		num, ok := r.s.Stream(r.samples[:num])
+		if !ok {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+		for _, sample := range r.samples[:num] {
+			var b [4]byte
+			binary.LittleEndian.PutUint16(b[0:], uint16(toInt16(sample[0])))
+			binary.LittleEndian.PutUint16(b[2:], uint16(toInt16(sample[1])))
+			c := copy(p[n:], b[:])
+			n += c
+			if c < 4 {
+				r.pending = append(r.pending[:0], b[c:]...)
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r *PCMReader) Seek(offset int64, whence int) (int64, error) {
+	pos := int64(r.s.Position())*4 - int64(len(r.pending))
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos += offset
+	case io.SeekEnd:
+		pos = int64(r.s.Len())*4 + offset
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	r.pending = r.pending[:0]
+	if err := r.s.Seek(int(pos / 4)); err != nil {
+		return 0, err
+	}
+	return pos / 4 * 4, nil
+}
+
+// Length in bytes
+func (r *PCMReader) Length() int64 {
+	return int64(r.s.Len()) * 4
+}
+
+func toInt16(v float64) int16 {
+	return int16(math.Max(-1, math.Min(1, v)) * math.MaxInt16)
+}
@@ -0,0 +1,264 @@
+package decoder
+
+// Time stretch by WSOLA, waveform similarity overlap add, as in Verhelst and
+// Roelands (1993). Frames are taken from the source at speed times the
+// output hop, and each is moved a little so it lines up with the end of the
+// frame before, the pitch is not changed.
+// To change pitch, the sound is stretched longer by the pitch ratio, then
+// played faster by the same ratio, resampled.
+
+import (
+	"math"
+	"sync"
+
+	"github.com/faiface/beep"
+)
+
+const (
+	stretchFrame     = 0.04 // second, frame of the overlap add
+	stretchTolerance = 0.01 // second, how far a frame may move to line up
+)
+
+// Stretcher play a streamer at a speed. Position, Len and Seek are in
+// samples of the stretched output, a source sample p is played at p/speed.
+type Stretcher struct {
+	mu        sync.Mutex
+	s         beep.StreamSeeker
+	speed     float64
+	semitones int
+	ratio     float64 // pitch ratio of semitones
+	frameSize int
+	hop       int // output hop, half a frame
+	tolerance int
+	window    []float64
+
+	out      int          // output position
+	start    int          // source position at output 0 of this speed
+	frames   int          // frames since start
+	natural  int          // source position following the last frame
+	src      [][2]float64 // source from srcBase
+	srcBase  int
+	srcEnd   bool
+	tail     [][2]float64 // second half of the last frame, to add to the next
+	ready    [][2]float64 // stretched, not yet resampled
+	readyPos float64      // position in ready of the next output
+}
+
+func NewStretcher(s beep.StreamSeeker, sampleRate int) *Stretcher {
+	frameSize := int(stretchFrame*float64(sampleRate)) / 2 * 2
+	st := &Stretcher{
+		s:         s,
+		speed:     1,
+		ratio:     1,
+		frameSize: frameSize,
+		hop:       frameSize / 2,
+		tolerance: int(stretchTolerance * float64(sampleRate)),
+		window:    make([]float64, frameSize),
+	}
+	// periodic hann, frames at half overlap sum to one
+	for i := range st.window {
+		st.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize))
+	}
+	st.reset(0)
+	return st
+}
+
+// Speed of playback, 1 is normal
+func (st *Stretcher) Speed() float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.speed
+}
+
+// SetSpeed change speed, playing on from the same source position, which
+// is then at a new output position
+func (st *Stretcher) SetSpeed(speed float64) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	src := st.sourcePos()
+	st.speed = speed
+	return st.seekSource(src)
+}
+
+// Semitones of pitch shift
+func (st *Stretcher) Semitones() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.semitones
+}
+
+// SetSemitones shift pitch up or down, at the same speed
+func (st *Stretcher) SetSemitones(semitones int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	src := st.sourcePos()
+	st.semitones = semitones
+	st.ratio = math.Pow(2, float64(semitones)/12)
+	return st.seekSource(src)
+}
+
+func (st *Stretcher) Stream(samples [][2]float64) (int, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.bypass() {
+		n, ok := st.s.Stream(samples)
+		st.out += n
+		return n, ok
+	}
+	n := 0
+	for ; n < len(samples); n++ {
+		i := int(st.readyPos)
+		for i+1 >= len(st.ready) {
+			if !st.nextFrame() {
+				st.out += n
+				return n, n > 0
+			}
+		}
+		// linear interpolation
+		f := st.readyPos - float64(i)
+		a, b := st.ready[i], st.ready[i+1]
+		samples[n] = [2]float64{a[0] + (b[0]-a[0])*f, a[1] + (b[1]-a[1])*f}
+		st.readyPos += st.ratio
+	}
+	if i := int(st.readyPos); i > 0 && i <= len(st.ready) {
+		st.ready = append(st.ready[:0], st.ready[i:]...)
+		st.readyPos -= float64(i)
+	}
+	st.out += n
+	return n, true
+}
+
+func (st *Stretcher) Err() error {
+	return st.s.Err()
+}
+
+func (st *Stretcher) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return int(float64(st.s.Len()) / st.speed)
+}
+
+func (st *Stretcher) Position() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.out
+}
+
+func (st *Stretcher) Seek(p int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.seekSource(int(math.Round(float64(p) * st.speed)))
+}
+
+// normal speed and pitch, the source is played as it is
+func (st *Stretcher) bypass() bool {
+	return st.speed == 1 && st.semitones == 0
+}
+
+// source position of the next streamed sample
+func (st *Stretcher) sourcePos() int {
+	if st.bypass() {
+		return st.s.Position()
+	}
+	return int(math.Round(float64(st.out) * st.speed))
+}
+
+func (st *Stretcher) seekSource(src int) error {
+	if src > st.s.Len() {
+		src = st.s.Len()
+	}
+	if err := st.s.Seek(src); err != nil {
+		return err
+	}
+	st.reset(src)
+	return nil
+}
+
+func (st *Stretcher) reset(src int) {
+	st.out = int(math.Round(float64(src) / st.speed))
+	st.start = src
+	st.frames = 0
+	st.natural = src
+	st.src = st.src[:0]
+	st.srcBase = src
+	st.srcEnd = false
+	st.tail = make([][2]float64, st.hop)
+	st.ready = st.ready[:0]
+	st.readyPos = 0
+}
+
+// fill read source up to position end, or to the end of source
+func (st *Stretcher) fill(end int) {
+	var buf [512][2]float64
+	for !st.srcEnd && st.srcBase+len(st.src) < end {
+		n, ok := st.s.Stream(buf[:])
+		st.src = append(st.src, buf[:n]...)
+		if !ok {
+			st.srcEnd = true
+		}
+	}
+}
+
+// source sample at p, silence outside the source
+func (st *Stretcher) at(p int) [2]float64 {
+	if i := p - st.srcBase; i >= 0 && i < len(st.src) {
+		return st.src[i]
+	}
+	return [2]float64{}
+}
+
+// source position of a frame, stretched longer by the pitch ratio
+func (st *Stretcher) nominal(frame int) int {
+	return st.start + int(math.Round(float64(frame)*float64(st.hop)*st.speed/st.ratio))
+}
+
+// nextFrame overlap add one more frame into ready, false at the end
+func (st *Stretcher) nextFrame() bool {
+	nominal := st.nominal(st.frames)
+	st.fill(nominal + st.tolerance + st.frameSize)
+	if st.srcEnd && nominal >= st.srcBase+len(st.src) {
+		return false
+	}
+
+	// frame most like the natural continuation of the last one
+	chosen := nominal
+	if st.frames > 0 {
+		best := math.Inf(-1)
+		for c := nominal - st.tolerance; c <= nominal+st.tolerance; c++ {
+			if c < st.srcBase {
+				continue
+			}
+			sum := 0.0
+			for i := 0; i < st.hop; i += 2 {
+				a, b := st.at(c+i), st.at(st.natural+i)
+				sum += (a[0] + a[1]) * (b[0] + b[1])
+			}
+			if sum > best {
+				best, chosen = sum, c
+			}
+		}
+	}
+
+	for i := 0; i < st.frameSize; i++ {
+		v := st.at(chosen + i)
+		w := st.window[i]
+		if i < st.hop {
+			st.ready = append(st.ready, [2]float64{st.tail[i][0] + v[0]*w, st.tail[i][1] + v[1]*w})
+		} else {
+			st.tail[i-st.hop] = [2]float64{v[0] * w, v[1] * w}
+		}
+	}
+	st.natural = chosen + st.hop
+	st.frames++
+
+	// drop source the next frame can not use
+	low := st.nominal(st.frames) - st.tolerance
+	if st.natural < low {
+		low = st.natural
+	}
+	if drop := low - st.srcBase; drop > 0 && drop <= len(st.src) {
+		st.src = append(st.src[:0], st.src[drop:]...)
+		st.srcBase += drop
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package decoder
+
+import (
+	"math"
+	"testing"
+)
+
+// sine on both channels, as a beep stream
+type sineStreamer struct {
+	rampStreamer
+	freq, rate float64
+}
+
+func (s *sineStreamer) Stream(samples [][2]float64) (int, bool) {
+	i := 0
+	for ; i < len(samples) && s.pos < s.n; i++ {
+		v := math.Sin(2 * math.Pi * s.freq * float64(s.pos) / s.rate)
+		samples[i] = [2]float64{v, v}
+		s.pos++
+	}
+	return i, i > 0
+}
+
+// zero crossings per second, about twice the frequency
+func crossingRate(samples [][2]float64, rate float64) float64 {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1][0] < 0) != (samples[i][0] < 0) {
+			n++
+		}
+	}
+	return float64(n) / (float64(len(samples)) / rate)
+}
+
+func TestStretcher(t *testing.T) {
+	rate := 8000
+	for _, speed := range []float64{0.5, 0.75, 1, 1.5} {
+		src := &sineStreamer{rampStreamer: rampStreamer{n: rate * 2}, freq: 440, rate: float64(rate)}
+		st := NewStretcher(src, rate)
+		if err := st.SetSpeed(speed); err != nil {
+			t.Fatal(err)
+		}
+		wantLen := int(float64(rate*2) / speed)
+		if st.Len() != wantLen {
+			t.Errorf("speed %.2f len got %d, want %d", speed, st.Len(), wantLen)
+		}
+		out := [][2]float64{}
+		buf := make([][2]float64, 300)
+		for {
+			n, ok := st.Stream(buf)
+			out = append(out, buf[:n]...)
+			if !ok {
+				break
+			}
+		}
+		if math.Abs(float64(len(out)-wantLen)) > float64(st.frameSize) {
+			t.Errorf("speed %.2f streamed %d samples, want about %d", speed, len(out), wantLen)
+		}
+		// pitch is kept, leave out the fade in of the first frame
+		if got := crossingRate(out[st.frameSize:], float64(rate)) / 2; math.Abs(got-440) > 10 {
+			t.Errorf("speed %.2f frequency got %.1f, want 440", speed, got)
+		}
+		if st.Position() != len(out) {
+			t.Errorf("speed %.2f position got %d, want %d", speed, st.Position(), len(out))
+		}
+
+		// seek is in output samples
+		if err := st.Seek(wantLen / 2); err != nil {
+			t.Fatal(err)
+		}
+		if src.pos != rate {
+			t.Errorf("speed %.2f seek to half, source at %d, want %d", speed, src.pos, rate)
+		}
+	}
+}
+
+func TestStretcherPitch(t *testing.T) {
+	rate := 8000
+	for _, tt := range []struct {
+		speed     float64
+		semitones int
+	}{{1, 12}, {1, -12}, {0.75, 5}, {0.5, -3}} {
+		src := &sineStreamer{rampStreamer: rampStreamer{n: rate * 2}, freq: 440, rate: float64(rate)}
+		st := NewStretcher(src, rate)
+		st.SetSpeed(tt.speed)
+		if err := st.SetSemitones(tt.semitones); err != nil {
+			t.Fatal(err)
+		}
+		out := [][2]float64{}
+		buf := make([][2]float64, 300)
+		for {
+			n, ok := st.Stream(buf)
+			out = append(out, buf[:n]...)
+			if !ok {
+				break
+			}
+		}
+		wantLen := int(float64(rate*2) / tt.speed)
+		if math.Abs(float64(len(out)-wantLen)) > float64(st.frameSize) {
+			t.Errorf("%+v streamed %d samples, want about %d", tt, len(out), wantLen)
+		}
+		want := 440 * math.Pow(2, float64(tt.semitones)/12)
+		if got := crossingRate(out[st.frameSize:], float64(rate)) / 2; math.Abs(got-want) > want*0.02 {
+			t.Errorf("%+v frequency got %.1f, want %.1f", tt, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package dft
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Analyser turn a window of samples into magnitude of each of the 88 keys
+type Analyser interface {
+	// number of samples needed for each analysis
+	WindowSize() int
+	SampleRate() int
+	// magnitude for each key in noteName, sample may be shorter than
+	// WindowSize at the end of file. It may be called from several
+	// goroutines at once, setters may not.
+	Analyse(sample []float64) map[string]float64
+}
+
+// Windowed is implemented by analysers accepting a window function
+type Windowed interface {
+	SetWindow(w *Window)
+}
+
+// Tuned is implemented by analysers accepting a tuning other than A440
+// equal temperament
+type Tuned interface {
+	SetTuning(t Tuning)
+}
+
+// GoertzelAnalyser perform PianoDFT on a fixed length window
+type GoertzelAnalyser struct {
+	sampleRate int
+	windowSize int
+	window     *Window
+	tuning     Tuning
+}
+
+func NewGoertzelAnalyser(sampleRate int, window time.Duration) *GoertzelAnalyser {
+	return &GoertzelAnalyser{
+		sampleRate: sampleRate,
+		windowSize: int(window.Seconds() * float64(sampleRate)),
+		window:     rectangularWindow,
+		tuning:     EqualTuning,
+	}
+}
+
+func (a *GoertzelAnalyser) WindowSize() int {
+	return a.windowSize
+}
+
+func (a *GoertzelAnalyser) SampleRate() int {
+	return a.sampleRate
+}
+
+func (a *GoertzelAnalyser) SetWindow(w *Window) {
+	a.window = w
+}
+
+func (a *GoertzelAnalyser) SetTuning(t Tuning) {
+	a.tuning = t
+}
+
+func (a *GoertzelAnalyser) Analyse(sample []float64) map[string]float64 {
+	return PianoDFTTuned(sample, a.sampleRate, a.window, a.tuning)
+}
+
+// names accepted by NewAnalyser
+var AnalyserNames = []string{"goertzel", "dft", "fft", "cqt"}
+
+// NewAnalyser create an analyser by name, so implementations can be
+// compared on the same file. window is ignored by cqt, its window length
+// is set by the lowest key.
+func NewAnalyser(name string, sampleRate int, window time.Duration) (Analyser, error) {
+	switch name {
+	case "goertzel":
+		return NewGoertzelAnalyser(sampleRate, window), nil
+	case "dft":
+		return NewDFTAnalyser(sampleRate, window), nil
+	case "fft":
+		return NewFFTAnalyser(sampleRate, window), nil
+	case "cqt":
+		return NewCQT(sampleRate, 1, 1), nil
+	}
+	return nil, fmt.Errorf("unknown analyser %q", name)
+}
+
+// AnalyserName return name of a in AnalyserNames, empty for other analysers
+func AnalyserName(a Analyser) string {
+	switch a.(type) {
+	case *GoertzelAnalyser:
+		return "goertzel"
+	case *DFTAnalyser:
+		return "dft"
+	case *FFTAnalyser:
+		return "fft"
+	case *CQT:
+		return "cqt"
+	}
+	return ""
+}
+
+// IsWindowed is true when analyser name accept a window function, others
+// use their own
+func IsWindowed(name string) bool {
+	a, err := NewAnalyser(name, 8000, time.Millisecond*10)
+	if err != nil {
+		return false
+	}
+	_, ok := a.(Windowed)
+	return ok
+}
+
+// DFTAnalyser perform NoteDFT with Euler formula on every key, it is slow,
+// kept as reference for the other analysers
+type DFTAnalyser struct {
+	sampleRate int
+	windowSize int
+	tuning     Tuning
+}
+
+func NewDFTAnalyser(sampleRate int, window time.Duration) *DFTAnalyser {
+	return &DFTAnalyser{
+		sampleRate: sampleRate,
+		windowSize: int(window.Seconds() * float64(sampleRate)),
+		tuning:     EqualTuning,
+	}
+}
+
+func (a *DFTAnalyser) WindowSize() int {
+	return a.windowSize
+}
+
+func (a *DFTAnalyser) SampleRate() int {
+	return a.sampleRate
+}
+
+func (a *DFTAnalyser) SetTuning(t Tuning) {
+	a.tuning = t
+}
+
+func (a *DFTAnalyser) Analyse(sample []float64) map[string]float64 {
+	noteValue := make(map[string]float64, len(noteName))
+	for i, key := range noteName {
+		noteValue[key] = freqDFT(sample, a.tuning.freq(i), pianoCycles, a.sampleRate)
+	}
+	return noteValue
+}
+
+// FFTAnalyser perform one FFT on the window, and each key take the
+// strongest FFT bin within half a semitone of the key. Bass keys are
+// closer than the bin width, those take the nearest bin.
+type FFTAnalyser struct {
+	sampleRate int
+	windowSize int
+	window     *Window
+	fftLen     int
+	work       *sync.Pool // of *fftWork
+	binLow     []int      // FFT bin range of each key, in noteName order
+	binHigh    []int
+}
+
+// fftWork is the scratch space of one FFT, analysers keep a pool of them so
+// Analyse can run on several goroutines
+type fftWork struct {
+	fft   *fourier.FFT
+	frame []float64 // zero padded input, len of fft
+	coeff []complex128
+}
+
+func newFFTPool(n int) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		return &fftWork{fft: fourier.NewFFT(n), frame: make([]float64, n)}
+	}}
+}
+
+func NewFFTAnalyser(sampleRate int, window time.Duration) *FFTAnalyser {
+	a := &FFTAnalyser{
+		sampleRate: sampleRate,
+		windowSize: int(window.Seconds() * float64(sampleRate)),
+		window:     rectangularWindow,
+	}
+	fftLen := 1
+	for fftLen < a.windowSize {
+		fftLen *= 2
+	}
+	a.fftLen = fftLen
+	a.work = newFFTPool(fftLen)
+	a.SetTuning(EqualTuning)
+	return a
+}
+
+// SetTuning recompute FFT bins of each key
+func (a *FFTAnalyser) SetTuning(t Tuning) {
+	fftLen := a.fftLen
+	binWidth := float64(a.sampleRate) / float64(fftLen)
+	halfSemitone := math.Pow(2, 1./24.)
+	a.binLow = a.binLow[:0]
+	a.binHigh = a.binHigh[:0]
+	for i := range noteName {
+		f := t.freq(i)
+		low := int(math.Ceil(f / halfSemitone / binWidth))
+		high := int(math.Floor(f * halfSemitone / binWidth))
+		if low > high {
+			low = int(math.Round(f / binWidth))
+			high = low
+		}
+		if high > fftLen/2 {
+			high = fftLen / 2
+		}
+		a.binLow = append(a.binLow, low)
+		a.binHigh = append(a.binHigh, high)
+	}
+}
+
+func (a *FFTAnalyser) WindowSize() int {
+	return a.windowSize
+}
+
+func (a *FFTAnalyser) SampleRate() int {
+	return a.sampleRate
+}
+
+func (a *FFTAnalyser) SetWindow(w *Window) {
+	a.window = w
+}
+
+func (a *FFTAnalyser) Analyse(sample []float64) map[string]float64 {
+	w := a.work.Get().(*fftWork)
+	defer a.work.Put(w)
+	n := copy(w.frame, sample)
+	for i := n; i < len(w.frame); i++ {
+		w.frame[i] = 0
+	}
+	noteValue := make(map[string]float64, len(noteName))
+	if n == 0 {
+		return noteValue
+	}
+	// normalise by sum of window, so a sine has the same magnitude under
+	// any window
+	sum := 0.0
+	for i, c := range a.window.Coefficients(n) {
+		w.frame[i] *= c
+		sum += c
+	}
+	w.coeff = w.fft.Coefficients(w.coeff, w.frame)
+	for i, key := range noteName {
+		v := 0.0
+		for b := a.binLow[i]; b <= a.binHigh[i]; b++ {
+			v = math.Max(v, cmplx.Abs(w.coeff[b]))
+		}
+		// same scale as NoteDFT
+		noteValue[key] = v / sum
+	}
+	return noteValue
+}
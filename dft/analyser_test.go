@@ -0,0 +1,25 @@
+package dft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalysersFindNote(t *testing.T) {
+	for _, name := range AnalyserNames {
+		a, err := NewAnalyser(name, 44100, time.Millisecond*100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample := generateSin(NoteFreq["E5"], 44100, a.WindowSize())
+		sp := a.Analyse(sample)
+		for _, key := range noteName {
+			if sp[key] > sp["E5"] {
+				t.Errorf("%s: %s %f stronger than E5 %f", name, key, sp[key], sp["E5"])
+			}
+		}
+	}
+	if _, err := NewAnalyser("wavelet", 44100, time.Second); err == nil {
+		t.Error("want error for unknown analyser")
+	}
+}
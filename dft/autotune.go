@@ -0,0 +1,73 @@
+package dft
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// Estimate how far a recording is tuned away from A440. Around every key,
+// energy is measured at a few cents offsets, and summed over the file.
+// Offsets wrap around a semitone, so the energy is summed as vectors on a
+// circle of 100 cents, the angle of the sum is the offset.
+
+const (
+	tuningStep    = 10                     // cents between offsets
+	tuningWindow  = time.Millisecond * 200 // long enough to separate 10 cents at A4
+	tuningFrames  = 60                     // max number of windows over the file
+	tuningLowKey  = 24                     // A2, lower keys are too close to resolve
+	tuningHighKey = 75                     // C7
+)
+
+// EstimateTuning return cents away from A440 equal temperament of the file
+// in k, between -50 and 50. Return ctx.Err() when ctx is done first.
+func EstimateTuning(ctx context.Context, k *Keys) (float64, error) {
+	sampleRate := k.SampleRate()
+	n := k.buffer.Format().SampleRate.N(tuningWindow)
+	window := Hann().Coefficients(n)
+
+	frames := int(k.Len() / tuningWindow)
+	if frames > tuningFrames {
+		frames = tuningFrames
+	}
+	if frames < 1 {
+		frames = 1
+	}
+	step := k.Len() / time.Duration(frames)
+
+	offsets := []float64{}
+	coeffs := []float64{}
+	for i := tuningLowKey; i <= tuningHighKey; i++ {
+		for c := -50.; c < 50; c += tuningStep {
+			f := EqualTuning.freq(i) * math.Pow(2, c/1200)
+			offsets = append(offsets, c)
+			coeffs = append(coeffs, 2*math.Cos(2*math.Pi*f/float64(sampleRate)))
+		}
+	}
+
+	energy := map[float64]float64{}
+	for f := 0; f < frames; f++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		start := k.buffer.Format().SampleRate.N(step * time.Duration(f))
+		sample := k.samples(start, n)
+		if len(sample) < n {
+			break
+		}
+		for i, coeff := range coeffs {
+			v := goertzelWindow(sample, coeff, window)
+			energy[offsets[i]] += v * v
+		}
+	}
+
+	sum := complex(0, 0)
+	for c, e := range energy {
+		sum += cmplx.Rect(e, 2*math.Pi*c/100)
+	}
+	if sum == 0 {
+		return 0, nil
+	}
+	return cmplx.Phase(sum) / (2 * math.Pi) * 100, nil
+}
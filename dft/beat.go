@@ -0,0 +1,195 @@
+package dft
+
+// Tempo and beat tracking, as in Ellis (2007), "Beat Tracking by Dynamic
+// Programming". Onsets are where keys get louder, the tempo is the period
+// the onsets repeat most, and beats are placed on strong onsets about one
+// period apart.
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"time"
+)
+
+const (
+	beatMinBPM    = 40.
+	beatMaxBPM    = 240.
+	beatPriorBPM  = 120. // tempo is more likely around this
+	beatTightness = 100. // how much beats keep to the tempo
+	BeatsPerBar   = 4    // assume 4/4
+	beatLineWidth = 1    // pixel
+	barLineWidth  = 2
+)
+
+// BeatGrid is beats of a piece, and the beats starting a bar
+type BeatGrid struct {
+	BPM   float64
+	Beats []time.Duration
+	Bars  []time.Duration
+}
+
+// OnsetEnvelope return how much louder keys get at each window, spectral
+// flux normalised
+func OnsetEnvelope(spectra []map[string]float64) []float64 {
+	onset := SpectralFlux(spectra)
+	// zero mean, unit deviation, so tightness mean the same for every file
+	mean, dev := 0.0, 0.0
+	for _, v := range onset {
+		mean += v / float64(len(onset))
+	}
+	for _, v := range onset {
+		dev += (v - mean) * (v - mean) / float64(len(onset))
+	}
+	dev = math.Sqrt(dev)
+	for i := range onset {
+		onset[i] -= mean
+		if dev > 0 {
+			onset[i] /= dev
+		}
+	}
+	return onset
+}
+
+// beatPeriod return period of beats in windows, the lag where onset is
+// most like itself, weighted towards beatPriorBPM. 0 if onset is too short.
+func beatPeriod(onset []float64, spacing time.Duration) float64 {
+	toLag := func(bpm float64) float64 { return 60. / bpm / spacing.Seconds() }
+	minLag := int(math.Max(1, math.Floor(toLag(beatMaxBPM))))
+	maxLag := int(math.Ceil(toLag(beatMinBPM)))
+	if maxLag >= len(onset) {
+		maxLag = len(onset) - 1
+	}
+	if minLag+1 >= maxLag {
+		return 0
+	}
+	score := make([]float64, maxLag+2)
+	for lag := minLag; lag <= maxLag+1 && lag < len(onset); lag++ {
+		ac := 0.0
+		for i := lag; i < len(onset); i++ {
+			ac += onset[i] * onset[i-lag]
+		}
+		ac /= float64(len(onset) - lag)
+		// log gaussian, one octave wide
+		octave := math.Log2(float64(lag) / toLag(beatPriorBPM))
+		score[lag] = ac * math.Exp(-0.5*octave*octave)
+	}
+	best := minLag
+	for lag := minLag; lag <= maxLag; lag++ {
+		if score[lag] > score[best] {
+			best = lag
+		}
+	}
+	// parabola through the peak, the period is rarely a whole window
+	period := float64(best)
+	if best > minLag && best < maxLag {
+		a, b, c := score[best-1], score[best], score[best+1]
+		if d := a - 2*b + c; d < 0 {
+			period += 0.5 * (a - c) / d
+		}
+	}
+	return period
+}
+
+// EstimateTempo return tempo of spectra analysed every spacing, in beats
+// per minute, 0 if it is too short to tell
+func EstimateTempo(spectra []map[string]float64, spacing time.Duration) float64 {
+	period := beatPeriod(OnsetEnvelope(spectra), spacing)
+	if period == 0 {
+		return 0
+	}
+	return 60. / (period * spacing.Seconds())
+}
+
+// TrackBeats find tempo, beats and bars of spectra analysed every spacing
+func TrackBeats(spectra []map[string]float64, spacing time.Duration) BeatGrid {
+	onset := OnsetEnvelope(spectra)
+	period := beatPeriod(onset, spacing)
+	if period == 0 {
+		return BeatGrid{}
+	}
+
+	// best score of a beat at each window, and the beat before it
+	score := make([]float64, len(onset))
+	prev := make([]int, len(onset))
+	for t := range onset {
+		prev[t] = -1
+		best := 0.0
+		from := t - int(math.Round(2*period))
+		to := t - int(math.Round(period/2))
+		for p := from; p <= to; p++ {
+			if p < 0 {
+				continue
+			}
+			d := math.Log(float64(t-p) / period)
+			s := score[p] - beatTightness*d*d
+			// a beat can also be the first one, with no beat before it
+			if s > best {
+				best, prev[t] = s, p
+			}
+		}
+		score[t] = onset[t] + best
+	}
+
+	// last beat is the best one within a period of the end
+	last := len(score) - 1
+	for t := len(score) - int(math.Round(period)); t < len(score); t++ {
+		if t >= 0 && score[t] > score[last] {
+			last = t
+		}
+	}
+	frames := []int{}
+	for t := last; t >= 0; t = prev[t] {
+		frames = append([]int{t}, frames...)
+	}
+
+	// downbeat on the bar phase with the strongest onsets
+	var phase [BeatsPerBar]float64
+	for i, t := range frames {
+		phase[i%BeatsPerBar] += onset[t]
+	}
+	first := 0
+	for i := range phase {
+		if phase[i] > phase[first] {
+			first = i
+		}
+	}
+
+	grid := BeatGrid{BPM: 60. / (period * spacing.Seconds())}
+	for i, t := range frames {
+		at := time.Duration(t) * spacing
+		grid.Beats = append(grid.Beats, at)
+		if i%BeatsPerBar == first {
+			grid.Bars = append(grid.Bars, at)
+		}
+	}
+	return grid
+}
+
+// Beats track beats in spectra of the first channel from AnalyseAll
+func (k *Keys) Beats() BeatGrid {
+	k.dataMu.Lock()
+	defer k.dataMu.Unlock()
+	return TrackBeats(FirstChannel(k.spectrum), k.spacing)
+}
+
+// DrawBeatGrid draw beat and bar lines to lay over a roll of frames windows
+// analysed every spacing, height pixel each, drawn as DrawSpectrum
+func DrawBeatGrid(grid BeatGrid, spacing time.Duration, frames, height int) image.Image {
+	imageHeight := frames * height
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	line := func(at time.Duration, width int, colour color.Color) {
+		// bottom of the strip at time at, roll go up with time
+		y := imageHeight - int(float64(at)/float64(spacing)*float64(height))
+		r := image.Rect(0, y-width, imageWidth, y)
+		draw.Draw(img, r, &image.Uniform{colour}, image.Point{}, draw.Over)
+	}
+	for _, at := range grid.Beats {
+		line(at, beatLineWidth, color.NRGBA{255, 255, 255, 60})
+	}
+	for _, at := range grid.Bars {
+		line(at, barLineWidth, color.NRGBA{255, 255, 255, 140})
+	}
+	return img
+}
@@ -0,0 +1,56 @@
+package dft
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrackBeats(t *testing.T) {
+	// a chord on every beat from 0.3s, 120 bpm, louder on the first of a bar
+	spacing := time.Millisecond * 100
+	spectra := make([]map[string]float64, 200)
+	for i := range spectra {
+		spectra[i] = map[string]float64{"A4": 0.01}
+		if i >= 3 && (i-3)%5 == 0 {
+			v := 0.5
+			if (i-3)%20 == 0 {
+				v = 1
+			}
+			spectra[i] = map[string]float64{"A4": v, "Cs5": v, "E5": v}
+		}
+	}
+	grid := TrackBeats(spectra, spacing)
+	if math.Abs(grid.BPM-120) > 2 {
+		t.Errorf("bpm got %.1f, want 120", grid.BPM)
+	}
+	if len(grid.Beats) < 35 {
+		t.Fatalf("got %d beats, want about 40", len(grid.Beats))
+	}
+	for _, at := range grid.Beats {
+		if (at-300*time.Millisecond)%(500*time.Millisecond) != 0 {
+			t.Errorf("beat at %v, not on a chord", at)
+		}
+	}
+	for _, at := range grid.Bars {
+		if (at-300*time.Millisecond)%(2*time.Second) != 0 {
+			t.Errorf("bar at %v, not on a loud chord", at)
+		}
+	}
+
+	img := DrawBeatGrid(grid, spacing, len(spectra), 10)
+	if got := img.Bounds().Dy(); got != 2000 {
+		t.Errorf("grid height got %d, want 2000", got)
+	}
+	// first beat is at the bottom of the fourth strip
+	if _, _, _, a := img.At(400, 2000-30-1).RGBA(); a == 0 {
+		t.Errorf("no line at first beat")
+	}
+	if _, _, _, a := img.At(400, 2000-35).RGBA(); a != 0 {
+		t.Errorf("line between beats")
+	}
+
+	if got := TrackBeats(spectra[:3], spacing); len(got.Beats) != 0 {
+		t.Errorf("too short got %d beats", len(got.Beats))
+	}
+}
@@ -2,6 +2,8 @@ package dft
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"image"
 	"image/png"
 	"log"
@@ -9,27 +11,38 @@ import (
 	"time"
 
 	"github.com/faiface/beep"
+	"iatearock.com/musicroll/decoder"
 )
 
+// samples read from the stream at a time
+const streamChunk = 1024
+
 type Keys struct {
 	filepath string
 	mu       sync.Mutex // combine buffer lock
 	s        beep.StreamSeekCloser
 	buffer   *beep.Buffer // [sample][channel]float64
-	combine  []float64    // each value is a sample, sum or left and right
-
-	combineStart int // combine indexes
-	combineEnd   int
-	windowStart  int // analysis window indexes
-	windowEnd    int
+	// one buffer for each analysed channel, each value is a sample made
+	// from left and right, only the samples of the current window are kept
+	combine   []*ringBuffer
+	frame     [][]float64 // samples of the current window, returned by samples
+	channels  []string    // analysed channels, from ChannelNames
+	channelFn []func(l, r float64) float64
+	split     bool // draw channels side by side, instead of colour coded
 
 	windowSize int
+	analyser   Analyser
+	window     *Window
+	tuning     Tuning
+	post       PostProcess  // applied to every spectrum, may be nil
+	salience   string       // name of post in PostProcessNames
+	pre        Preprocessor // applied to samples before analysis, may be nil
 
 	fileLength time.Duration
 	spacing    time.Duration // how frequent is a DFT is performed
 	dataMu     sync.Mutex
-	spectrum   []map[string]float64
-	progress   float64 // num specturm analysed out of whole file
+	spectrum   [][]map[string]float64 // [window][channel]
+	progress   float64                // num specturm analysed out of whole file
 
 	image   image.Image
 	imageMu sync.Mutex
@@ -38,21 +51,16 @@ type Keys struct {
 func NewKeys(f beep.Format, s beep.StreamSeekCloser, filepath string) *Keys {
 	initDraw()
 	k := &Keys{
-		filepath:     filepath,
-		combine:      []float64{},
-		combineStart: 0,
-		combineEnd:   0,
-		windowStart:  0,
-		windowEnd:    0,
+		filepath: filepath,
+		tuning:   EqualTuning,
+		salience: "none",
 	}
 	k.buffer = beep.NewBuffer(f)
 	k.s = s
-	// hardcode 0.1 second window size
-	k.windowSize = f.SampleRate.N(time.Millisecond * 100)
-	k.windowEnd = k.windowSize
-	for k.windowEnd > k.combineEnd {
-		k.nextBuffer()
-	}
+	// default 0.1 second window size
+	k.analyser = NewGoertzelAnalyser(f.SampleRate.N(time.Second), time.Millisecond*100)
+	k.windowSize = k.analyser.WindowSize()
+	k.SetChannels([]string{"mix"})
 	k.fileLength = f.SampleRate.D(s.Len())
 	// k.spacing = time.Millisecond * 100
 	k.SetSpacing(time.Second * 1)
@@ -60,60 +68,284 @@ func NewKeys(f beep.Format, s beep.StreamSeekCloser, filepath string) *Keys {
 	return k
 }
 
-// AnalyseAll perform PianoDFT for the entire file
-func (k *Keys) AnalyseAll() []map[string]float64 {
-	totalDataPoints := float64((k.Len() / k.spacing) + 1)
-	// log.Printf("expecting %f data points", totalDataPoints)
+// OpenKeys decode a sound file and create Keys for it, Close when done
+func OpenKeys(path string) (*Keys, error) {
+	snd, err := decoder.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeys(snd.Format, snd, path), nil
+}
+
+// Close the sound file
+func (k *Keys) Close() error {
+	return k.s.Close()
+}
+
+// AnalyseAll perform PianoDFT for the entire file, stop when ctx is done
+// and return spectra so far with ctx.Err(), [window][channel]
+func (k *Keys) AnalyseAll(ctx context.Context) ([][]map[string]float64, error) {
 	current := time.Millisecond * 0
 	stripCount := 0
 	imageHeight := k.image.Bounds().Dy()
 	for current < k.fileLength {
+		if err := ctx.Err(); err != nil {
+			return k.spectrum, err
+		}
 		// log.Println(current)
-		sp := k.Analyse(current)
-		strip := DrawNewStripe(sp, 0.001, 10)
+		sp := k.AnalyseChannels(current)
+		strip := DrawChannelStripe(sp, 0.001, 10, k.split)
 		k.imageMu.Lock()
 		k.image = DrawOnImage(k.image, strip,
 			image.Point{0, imageHeight - ((stripCount + 1) * 10)})
 		k.imageMu.Unlock()
-		k.dataMu.Lock()
-		k.spectrum = append(k.spectrum, sp)
-		k.progress = float64(len(k.spectrum)) / totalDataPoints
-		k.dataMu.Unlock()
+		k.AppendSpectrum(sp)
 		current += k.spacing
 		stripCount += 1
 	}
-	return k.spectrum
+	return k.spectrum, nil
 }
 
-// Analyse spectrum at time t
+// AppendSpectrum keep spectrum of every channel of the next window, for when
+// windows are analysed one by one instead of AnalyseAll
+func (k *Keys) AppendSpectrum(sp []map[string]float64) {
+	totalDataPoints := float64((k.Len() / k.spacing) + 1)
+	k.dataMu.Lock()
+	k.spectrum = append(k.spectrum, sp)
+	k.progress = float64(len(k.spectrum)) / totalDataPoints
+	k.dataMu.Unlock()
+}
+
+// Notes segment spectra of the first channel from AnalyseAll into notes
+func (k *Keys) Notes(opts SegmentOptions) []NoteEvent {
+	k.dataMu.Lock()
+	defer k.dataMu.Unlock()
+	return DetectNotes(FirstChannel(k.spectrum), k.spacing, opts)
+}
+
+// Analyse spectrum of the first channel at time t
 func (k *Keys) Analyse(t time.Duration) map[string]float64 {
-	k.windowStart = k.buffer.Format().SampleRate.N(t)
-	k.windowEnd = k.windowStart + k.windowSize
-	for k.windowEnd > k.combineEnd {
-		k.nextBuffer()
+	return k.analyse(k.windowSamples(k.buffer.Format().SampleRate.N(t))[0])
+}
+
+// AnalyseChannels return spectrum of every channel at time t
+func (k *Keys) AnalyseChannels(t time.Duration) []map[string]float64 {
+	sp := []map[string]float64{}
+	for _, sample := range k.windowSamples(k.buffer.Format().SampleRate.N(t)) {
+		sp = append(sp, k.analyse(sample))
+	}
+	return sp
+}
+
+// windowSamples return samples of every channel of the analysis window
+// from index start, after the preprocessor
+func (k *Keys) windowSamples(start int) [][]float64 {
+	if k.pre == nil {
+		return k.channelSamples(start, k.windowSize)
+	}
+	from := start - k.pre.Context()
+	if from < 0 {
+		from = 0
+	}
+	samples := [][]float64{}
+	for _, sample := range k.channelSamples(from, start-from+k.windowSize+k.pre.Context()) {
+		sample = k.pre.Process(sample)
+		s, e := start-from, start-from+k.windowSize
+		if e > len(sample) {
+			e = len(sample)
+		}
+		if s > e {
+			s = e
+		}
+		samples = append(samples, sample[s:e])
+	}
+	return samples
+}
+
+// SetPreprocess set a transform applied to samples before analysis, e.g.
+// HPSS, nil to analyse samples as they are
+func (k *Keys) SetPreprocess(p Preprocessor) {
+	k.pre = p
+}
+
+func (k *Keys) analyse(sample []float64) map[string]float64 {
+	sp := k.analyser.Analyse(sample)
+	if k.post != nil {
+		sp = k.post(sp)
 	}
-	// log.Println(k.windowStart, k.windowEnd, k.combine[k.windowStart:k.windowStart+10])
-	return PianoDFT(k.combine[k.windowStart:k.windowEnd],
-		k.buffer.Format().SampleRate.N(time.Second))
+	return sp
+}
+
+// SetChannels set channels analysed from left and right, names from
+// ChannelNames, default is mix only. Set it before analysis.
+func (k *Keys) SetChannels(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no channel")
+	}
+	fns := []func(l, r float64) float64{}
+	for _, name := range names {
+		fn, err := channelFunc(name)
+		if err != nil {
+			return err
+		}
+		fns = append(fns, fn)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.channels = names
+	k.channelFn = fns
+	pos := 0
+	if len(k.combine) > 0 {
+		pos = k.combine[0].end
+	}
+	k.combine = make([]*ringBuffer, len(names))
+	k.frame = make([][]float64, len(names))
+	for c := range names {
+		k.combine[c] = newRingBuffer(k.windowSize + streamChunk)
+		k.combine[c].reset(pos)
+	}
+	return nil
+}
+
+func (k *Keys) Channels() []string {
+	return k.channels
+}
+
+// SetSplit draw channels side by side, instead of colour coded on one roll
+func (k *Keys) SetSplit(split bool) {
+	k.split = split
+}
+
+// SetPostProcess set a transform applied to every spectrum, e.g.
+// SuppressHarmonics, nil to draw raw magnitude
+func (k *Keys) SetPostProcess(p PostProcess) {
+	k.post = p
+	k.salience = "custom"
+	if p == nil {
+		k.salience = "none"
+	}
+}
+
+// SetSalience set post process by name in PostProcessNames, the name is
+// kept in spectrum files
+func (k *Keys) SetSalience(name string) error {
+	p, err := NewPostProcess(name)
+	if err != nil {
+		return err
+	}
+	k.SetPostProcess(p)
+	k.salience = name
+	return nil
+}
+
+// samples return n samples of the first channel from index start
+func (k *Keys) samples(start, n int) []float64 {
+	return k.channelSamples(start, n)[0]
+}
+
+// channelSamples return n samples of every channel from index start,
+// shorter at end of file. Slices are reused by the next call. Stream is
+// seeked when start is not in the buffer, so windows can be read in any
+// order.
+func (k *Keys) channelSamples(start, n int) [][]float64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// channels are read together, same position in every buffer
+	if start < k.combine[0].start || start > k.combine[0].end {
+		k.seek(start)
+	}
+	for _, r := range k.combine {
+		r.reserve(n + streamChunk)
+	}
+	for k.combine[0].end < start+n {
+		if k.nextBuffer() == 0 {
+			// end of file, analyse what is left
+			break
+		}
+	}
+	for c, r := range k.combine {
+		if cap(k.frame[c]) < n {
+			k.frame[c] = make([]float64, n)
+		}
+		k.frame[c] = k.frame[c][:r.copyTo(k.frame[c][:n], start)]
+	}
+	return k.frame
+}
+
+// move stream to sample index start, buffered samples are dropped
+func (k *Keys) seek(start int) {
+	if start > k.s.Len() {
+		start = k.s.Len()
+	}
+	if err := k.s.Seek(start); err != nil {
+		log.Printf("seek to %d : %v", start, err)
+		return
+	}
+	for _, r := range k.combine {
+		r.reset(start)
+	}
+}
+
+func (k *Keys) SampleRate() int {
+	return k.buffer.Format().SampleRate.N(time.Second)
+}
+
+// SetAnalyser replace the default PianoDFT analysis, e.g. with a CQT
+func (k *Keys) SetAnalyser(a Analyser) {
+	k.analyser = a
+	k.windowSize = a.WindowSize()
+	if w, ok := a.(Windowed); ok && k.window != nil {
+		w.SetWindow(k.window)
+	}
+	if t, ok := a.(Tuned); ok && k.tuning != EqualTuning {
+		t.SetTuning(k.tuning)
+	}
+}
+
+// SetWindow set window function for analysers that accept one, it is kept
+// for analyser set later
+func (k *Keys) SetWindow(w *Window) {
+	k.window = w
+	if a, ok := k.analyser.(Windowed); ok {
+		a.SetWindow(w)
+	}
+}
+
+// SetTuning set reference pitch and temperament of the keys, it is kept
+// for analyser set later
+func (k *Keys) SetTuning(t Tuning) {
+	k.tuning = t
+	if a, ok := k.analyser.(Tuned); ok {
+		a.SetTuning(t)
+	}
+}
+
+func (k *Keys) Tuning() Tuning {
+	return k.tuning
+}
+
+func (k *Keys) Analyser() Analyser {
+	return k.analyser
 }
 
 // GetSpectrum return spectrum data
 // `got` is the number of specturm already recieved, this function return
 // new specturm not send before
-func (k *Keys) GetSpectrum(got int) []map[string]float64 {
+func (k *Keys) GetSpectrum(got int) [][]map[string]float64 {
 	k.dataMu.Lock()
 	defer k.dataMu.Unlock()
 	log.Println(got, len(k.spectrum))
 	if got > len(k.spectrum) {
-		return []map[string]float64{}
+		return [][]map[string]float64{}
 	}
 	return k.spectrum[got:]
 }
 
-// Draw 1 strip to the final image, with 1 spectrum, and index of the strip
-func (k *Keys) DrawStripe(spectrum map[string]float64, stripCount int) {
+// Draw 1 strip to the final image, with spectrum of every channel, and
+// index of the strip
+func (k *Keys) DrawStripe(spectrum []map[string]float64, stripCount int) {
 	imageHeight := k.image.Bounds().Dy()
-	strip := DrawNewStripe(spectrum, 0.001, 10)
+	strip := DrawChannelStripe(spectrum, 0.001, 10, k.split)
 	k.imageMu.Lock()
 	k.image = DrawOnImage(k.image, strip,
 		image.Point{0, imageHeight - ((stripCount + 1) * 10)})
@@ -168,28 +400,26 @@ func (k *Keys) Len() time.Duration {
 	return k.fileLength
 }
 
+// TrimBuffer drop buffered samples, they are read again when needed
 func (k *Keys) TrimBuffer() {
-	// TODO trim used buffer
 	k.mu.Lock()
-	k.combine = []float64{}
 	defer k.mu.Unlock()
+	for _, r := range k.combine {
+		r.reset(r.end)
+	}
 }
 
+// read next chunk of stream into combine, return number of samples read
 func (k *Keys) nextBuffer() int {
-	var samples [1024][2]float64
+	var samples [streamChunk][2]float64
 	n, ok := k.s.Stream(samples[:])
 	if !ok {
 		return 0
 	}
 	for _, sample := range samples[:n] {
-		sum := 0.0
-		for _, channel := range sample {
-			sum += channel
+		for c, fn := range k.channelFn {
+			k.combine[c].push(fn(sample[0], sample[1]))
 		}
-		k.mu.Lock()
-		k.combine = append(k.combine, sum)
-		k.combineEnd += 1
-		k.mu.Unlock()
 	}
 	return n
 }
@@ -1,17 +1,15 @@
 package dft
 
 import (
-	"errors"
+	"context"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/faiface/beep"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/vorbis"
 	"github.com/faiface/beep/wav"
 )
 
@@ -51,7 +49,7 @@ func TestXxx(t *testing.T) {
 	// 	log.Printf("%s, %0.4f", k, v)
 	// }
 	now := time.Now()
-	sp := k.AnalyseAll()
+	sp, _ := k.AnalyseAll(context.Background())
 	elapsed := time.Since(now)
 	log.Println(time.Since(now).String())
 
@@ -69,7 +67,7 @@ func TestXxx(t *testing.T) {
 	// bg := DrawSpectrum(sp, 10)
 
 	for i, spec := range sp {
-		log.Println(i, spec["C4"])
+		log.Println(i, spec[0]["C4"])
 		// 	img := DrawNewStripe(spec, 0.001, 10)
 		// 	bg = DrawOnImage(bg, img, image.Point{0, imageHeight - ((i + 1) * 10)})
 		// 	// err = Export(fmt.Sprintf("test%02d.png", i), img)
@@ -101,33 +99,162 @@ func TestGonumFFTData(t *testing.T) {
 }
 
 func loadFile(path string) (*Keys, error) {
+	keys, err := OpenKeys(path)
+	if err != nil {
+		return &Keys{}, err
+	}
+	keys.SetSpacing(time.Second)
+	return keys, nil
+}
+
+// mono signal as a beep stream, for Keys in tests
+type sliceStreamer struct {
+	data []float64
+	pos  int
+}
+
+func (s *sliceStreamer) Stream(samples [][2]float64) (int, bool) {
+	if s.pos >= len(s.data) {
+		return 0, false
+	}
+	n := 0
+	for ; n < len(samples) && s.pos < len(s.data); n++ {
+		// Keys sum the channels back
+		samples[n][0] = s.data[s.pos] / 2
+		samples[n][1] = s.data[s.pos] / 2
+		s.pos++
+	}
+	return n, true
+}
+
+func (s *sliceStreamer) Err() error    { return nil }
+func (s *sliceStreamer) Len() int      { return len(s.data) }
+func (s *sliceStreamer) Position() int { return s.pos }
+func (s *sliceStreamer) Close() error  { return nil }
+
+func (s *sliceStreamer) Seek(p int) error {
+	s.pos = p
+	return nil
+}
+
+func newTestKeys(data []float64, sampleRate int) *Keys {
+	f := beep.Format{SampleRate: beep.SampleRate(sampleRate), NumChannels: 2, Precision: 2}
+	return NewKeys(f, &sliceStreamer{data: data}, "test")
+}
+
+// stream of n samples, each sample is its own index, made as it is read
+type rampStreamer struct {
+	n, pos int
+}
+
+func (s *rampStreamer) Stream(samples [][2]float64) (int, bool) {
+	if s.pos >= s.n {
+		return 0, false
+	}
+	n := 0
+	for ; n < len(samples) && s.pos < s.n; n++ {
+		samples[n][0] = float64(s.pos) / 2
+		samples[n][1] = float64(s.pos) / 2
+		s.pos++
+	}
+	return n, true
+}
 
-	f, err := os.Open(path)
-	// f, err := os.Open("/home/raymond/Music/Ed Sheeran - The Joker And The Queen [Official Lyric Video]-m9f4XtNj1Vg.mp3")
+func (s *rampStreamer) Err() error    { return nil }
+func (s *rampStreamer) Len() int      { return s.n }
+func (s *rampStreamer) Position() int { return s.pos }
+func (s *rampStreamer) Close() error  { return nil }
+
+func (s *rampStreamer) Seek(p int) error {
+	s.pos = p
+	return nil
+}
+
+func newRampKeys(n, sampleRate int) *Keys {
+	f := beep.Format{SampleRate: beep.SampleRate(sampleRate), NumChannels: 2, Precision: 2}
+	return NewKeys(f, &rampStreamer{n: n}, "test")
+}
+
+func TestKeysSamples(t *testing.T) {
+	k := newRampKeys(100000, 8000)
+	// forward, back, overlapping, jump ahead, end of file
+	for _, start := range []int{0, 3000, 1000, 1500, 90000, 20000, 99000} {
+		sample := k.samples(start, 2000)
+		want := 2000
+		if start+want > 100000 {
+			want = 100000 - start
+		}
+		if len(sample) != want {
+			t.Fatalf("start %d got %d samples, want %d", start, len(sample), want)
+		}
+		for i, v := range sample {
+			if v != float64(start+i) {
+				t.Fatalf("start %d sample %d got %v", start, i, v)
+			}
+		}
+	}
+	if got := k.samples(200000, 10); len(got) != 0 {
+		t.Errorf("after end of file got %d samples", len(got))
+	}
+	k.TrimBuffer()
+	if got := k.samples(5, 1); len(got) != 1 || got[0] != 5 {
+		t.Errorf("after TrimBuffer got %v", got)
+	}
+}
+
+func TestKeysMemoryCeiling(t *testing.T) {
+	// an hour at 44.1kHz, 1.2 GB if every sample is kept
+	sampleRate := 44100
+	k := newRampKeys(sampleRate*3600, sampleRate)
+	k.SetSpacing(time.Second)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	n := k.windowSize
+	for current := time.Duration(0); current < k.Len(); current += k.Spacing() {
+		start := k.buffer.Format().SampleRate.N(current)
+		if sample := k.samples(start, n); sample[0] != float64(start) {
+			t.Fatalf("at %v got %v, want %v", current, sample[0], start)
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if len(k.combine[0].data) > n+streamChunk {
+		t.Errorf("buffer hold %d samples, window is %d", len(k.combine[0].data), n)
+	}
+	if grow := int64(after.HeapAlloc) - int64(before.HeapAlloc); grow > 1<<20 {
+		t.Errorf("heap grow %d bytes", grow)
+	}
+}
+
+// a file without extension, in a directory with a dot, is found by content
+func TestOpenKeysNoExtension(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".music")
+	os.Mkdir(dir, 0o755)
+	path := filepath.Join(dir, "song")
+	f, err := os.Create(path)
 	if err != nil {
-		return &Keys{}, errors.New("Error reading this file. (OpenFile) %s")
-	}
-	defer f.Close()
-	// defer f.Close()   // do not close f, streamer will cose it
-	ext := filepath.Ext(path)
-	var format beep.Format
-	var streamer beep.StreamSeekCloser
-	switch ext {
-	case ".mp3":
-		streamer, format, err = mp3.Decode(f)
-	case ".wav":
-		streamer, format, err = wav.Decode(f)
-	case ".ogg":
-		streamer, format, err = vorbis.Decode(f)
-	case ".flac":
-		streamer, format, err = flac.Decode(f)
-	default:
-		return &Keys{}, errors.New("Error, file format not recognised. (OpenFile)")
+		t.Fatal(err)
+	}
+	format := beep.Format{SampleRate: 8000, NumChannels: 2, Precision: 2}
+	data := generateSin(NoteFreq["A4"], 8000, 8000)
+	if err := wav.Encode(f, &sliceStreamer{data: data}, format); err != nil {
+		t.Fatal(err)
 	}
+	f.Close()
+
+	k, err := OpenKeys(path)
 	if err != nil {
-		return &Keys{}, errors.New("Error decoding this file. (OpenFile)")
+		t.Fatal(err)
+	}
+	defer k.Close()
+	k.SetSpacing(time.Millisecond * 100)
+	sp, err := k.AnalyseAll(context.Background())
+	if err != nil || len(sp) != k.NumFrames() {
+		t.Fatalf("analysed %d of %d frames, %v", len(sp), k.NumFrames(), err)
+	}
+	k.SaveImage(path + ".png")
+	if _, err := os.Stat(path + ".png"); err != nil {
+		t.Error(err)
 	}
-	keys := NewKeys(format, streamer, "test")
-	keys.SetSpacing(time.Second)
-	return keys, nil
 }
@@ -0,0 +1,117 @@
+package dft
+
+// Stereo channels. Keys can analyse several channels made from left and
+// right, each window then has one spectrum per channel, drawn side by side
+// or colour coded on one roll.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// names accepted by SetChannels, mix is left plus right as before
+var ChannelNames = []string{"mix", "left", "right", "mid", "side"}
+
+// hue of each channel on a combined roll, in order of analysed channels
+var channelColours = []color.RGBA{
+	{255, 60, 0, 255},  // orange
+	{0, 160, 255, 255}, // blue
+	{0, 220, 80, 255},  // green
+	{220, 0, 255, 255}, // purple
+	{255, 220, 0, 255}, // yellow
+}
+
+// channelFunc return how a channel is made from a left and right sample
+func channelFunc(name string) (func(l, r float64) float64, error) {
+	switch name {
+	case "mix":
+		return func(l, r float64) float64 { return l + r }, nil
+	case "left":
+		return func(l, r float64) float64 { return l }, nil
+	case "right":
+		return func(l, r float64) float64 { return r }, nil
+	case "mid":
+		return func(l, r float64) float64 { return (l + r) / 2 }, nil
+	case "side":
+		return func(l, r float64) float64 { return (l - r) / 2 }, nil
+	}
+	return nil, fmt.Errorf("unknown channel %q", name)
+}
+
+// FirstChannel return spectra of the first channel, from spectra of
+// [window][channel]
+func FirstChannel(spectra [][]map[string]float64) []map[string]float64 {
+	first := make([]map[string]float64, len(spectra))
+	for i, sp := range spectra {
+		first[i] = sp[0]
+	}
+	return first
+}
+
+// DrawChannelStripe draw one window of every channel. A single channel is
+// the same as DrawNewStripe. split draw each channel in its own column,
+// otherwise each channel has its own hue on one roll.
+func DrawChannelStripe(values []map[string]float64, maxValue float64, height int, split bool) image.Image {
+	if len(values) == 1 {
+		return DrawNewStripe(values[0], maxValue, height)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, height))
+	if split {
+		width := imageWidth / len(values)
+		for c, value := range values {
+			strip := DrawNewStripe(value, maxValue, height)
+			r := image.Rect(c*width, 0, (c+1)*width, height)
+			scaleX(img, r, strip)
+		}
+		return img
+	}
+	// same scale for every channel, so a louder side look louder
+	localMax := maxValue
+	for _, value := range values {
+		for _, v := range value {
+			localMax = math.Max(localMax, v)
+		}
+	}
+	for c, value := range values {
+		hue := channelColours[c%len(channelColours)]
+		for _, k := range noteName {
+			x := keyPosMid[k] * float64(imageWidth)
+			a := math.Pow(value[k]/localMax, 3)
+			if strings.Contains(k, "s") {
+				// black key a bit darker
+				a *= 0.8
+			}
+			colour := color.NRGBA{hue.R, hue.G, hue.B, uint8(a * 255)}
+			b := image.Rect(int(x)-5, 0, int(x)+5, height)
+			draw.Draw(img, b, &image.Uniform{colour}, image.Point{}, draw.Over)
+		}
+	}
+	return img
+}
+
+// scaleX draw src into r of dst, squeezed horizontally
+func scaleX(dst *image.RGBA, r image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := sb.Min.X + (x-r.Min.X)*sb.Dx()/r.Dx()
+			dst.Set(x, y, src.At(sx, sb.Min.Y+y-r.Min.Y))
+		}
+	}
+}
+
+// DrawChannelSpectrum draw spectra of [window][channel], as DrawSpectrum
+func DrawChannelSpectrum(s [][]map[string]float64, height int, split bool) image.Image {
+	imageHeight := len(s) * height
+	bg := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	for i, spec := range s {
+		img := DrawChannelStripe(spec, 0.001, height, split)
+		r := image.Rect(0, imageHeight-((i+1)*height), imageWidth, imageHeight-(i*height))
+		draw.Draw(bg, r, img, image.Point{}, draw.Src)
+	}
+	return bg
+}
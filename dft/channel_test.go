@@ -0,0 +1,114 @@
+package dft
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// left and right as a beep stream
+type stereoStreamer struct {
+	left, right []float64
+	pos         int
+}
+
+func (s *stereoStreamer) Stream(samples [][2]float64) (int, bool) {
+	if s.pos >= len(s.left) {
+		return 0, false
+	}
+	n := 0
+	for ; n < len(samples) && s.pos < len(s.left); n++ {
+		samples[n] = [2]float64{s.left[s.pos], s.right[s.pos]}
+		s.pos++
+	}
+	return n, true
+}
+
+func (s *stereoStreamer) Err() error    { return nil }
+func (s *stereoStreamer) Len() int      { return len(s.left) }
+func (s *stereoStreamer) Position() int { return s.pos }
+func (s *stereoStreamer) Close() error  { return nil }
+
+func (s *stereoStreamer) Seek(p int) error {
+	s.pos = p
+	return nil
+}
+
+func TestChannels(t *testing.T) {
+	sampleRate := 8000
+	left := generateSin(NoteFreq["A4"], sampleRate, sampleRate)
+	right := generateSin(NoteFreq["E5"], sampleRate, sampleRate)
+	f := beep.Format{SampleRate: beep.SampleRate(sampleRate), NumChannels: 2, Precision: 2}
+	k := NewKeys(f, &stereoStreamer{left: left, right: right}, "test")
+	if err := k.SetChannels([]string{"left", "right", "mid", "side"}); err != nil {
+		t.Fatal(err)
+	}
+	sp := k.AnalyseChannels(time.Millisecond * 200)
+	if len(sp) != 4 {
+		t.Fatalf("got %d channels, want 4", len(sp))
+	}
+	if sp[0]["A4"] < 10*sp[0]["E5"] {
+		t.Errorf("left A4 %f, E5 %f", sp[0]["A4"], sp[0]["E5"])
+	}
+	if sp[1]["E5"] < 10*sp[1]["A4"] {
+		t.Errorf("right A4 %f, E5 %f", sp[1]["A4"], sp[1]["E5"])
+	}
+	// both panned notes are in mid and side, at half
+	for _, c := range sp[2:] {
+		for _, key := range []string{"A4", "E5"} {
+			if c[key] < 0.4*sp[0]["A4"] || c[key] > 0.6*sp[0]["A4"] {
+				t.Errorf("%s got %f, want about %f", key, c[key], sp[0]["A4"]/2)
+			}
+		}
+	}
+	if err := k.SetChannels([]string{"centre"}); err == nil {
+		t.Error("want error for unknown channel")
+	}
+
+	// channels are kept in the spectrum file
+	k.AppendSpectrum(sp)
+	path := filepath.Join(t.TempDir(), "a.spectrum")
+	if err := k.SaveSpectrum(path); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Channels) != 4 || sf.Channels[3] != "side" || len(sf.Spectra[0]) != 4 {
+		t.Fatalf("got channels %v", sf.Channels)
+	}
+	if float32(sf.Spectra[0][1]["E5"]) != float32(sp[1]["E5"]) {
+		t.Errorf("right E5 got %f, want %f", sf.Spectra[0][1]["E5"], sp[1]["E5"])
+	}
+}
+
+func TestDrawChannelStripe(t *testing.T) {
+	initDraw()
+	left := map[string]float64{"A4": 1}
+	right := map[string]float64{"E5": 1}
+	y := 5
+	xA4 := int(keyPosMid["A4"] * float64(imageWidth))
+	xE5 := int(keyPosMid["E5"] * float64(imageWidth))
+
+	img := DrawChannelStripe([]map[string]float64{left, right}, 0.001, 10, false)
+	r, _, b, _ := img.At(xA4, y).RGBA()
+	if r <= b {
+		t.Errorf("left key should be in left hue, got r %d b %d", r, b)
+	}
+	r, _, b, _ = img.At(xE5, y).RGBA()
+	if b <= r {
+		t.Errorf("right key should be in right hue, got r %d b %d", r, b)
+	}
+
+	// side by side, right channel in the right half
+	img = DrawChannelStripe([]map[string]float64{left, right}, 0.001, 10, true)
+	if _, _, _, a := img.At(imageWidth/2+xE5/2, y).RGBA(); a == 0 {
+		t.Error("right channel not drawn in right half")
+	}
+	if _, _, _, a := img.At(xE5/2, y).RGBA(); a != 0 {
+		t.Error("right channel drawn in left half")
+	}
+}
@@ -0,0 +1,193 @@
+package dft
+
+// Chord recognition. Every spectrum is folded into 12 pitch classes
+// (chroma), and compared with templates of chords on each root.
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// semitones above the root of each chord quality, the key is the suffix of
+// the label, major has no suffix
+var chordTemplates = map[string][]int{
+	"":     {0, 4, 7},
+	"m":    {0, 3, 7},
+	"7":    {0, 4, 7, 10},
+	"maj7": {0, 4, 7, 11},
+	"m7":   {0, 3, 7, 10},
+	"dim":  {0, 3, 6},
+	"sus2": {0, 2, 7},
+	"sus4": {0, 5, 7},
+}
+
+// label of a window without a chord
+const NoChord = "N"
+
+const (
+	chordMinEnergy    = 0.05 // no chord below this ratio of the loudest window
+	chordMinScore     = 0.6  // no chord when best template match is below this
+	chordSmoothFrames = 5    // label is the most common in this many windows
+)
+
+type ChordEvent struct {
+	Label      string // e.g. "C", "F#m7", NoChord
+	Start, End time.Duration
+}
+
+// Chroma sum magnitude of keys of each pitch class, C is 0
+func Chroma(spectrum map[string]float64) [12]float64 {
+	var c [12]float64
+	for i, key := range noteName {
+		c[(i+9)%12] += spectrum[key] // noteName start at A
+	}
+	return c
+}
+
+// ChordLabel return name of a chord, sharp written as #
+func ChordLabel(root int, quality string) string {
+	return strings.Replace(PitchClassNames[root], "s", "#", 1) + quality
+}
+
+// MatchChord return label of the template closest to chroma, by cosine
+// similarity, and the similarity
+func MatchChord(chroma [12]float64) (string, float64) {
+	norm := 0.0
+	for _, v := range chroma {
+		norm += v * v
+	}
+	if norm == 0 {
+		return NoChord, 0
+	}
+	norm = math.Sqrt(norm)
+	// same order every time, so ties go to the same chord
+	qualities := make([]string, 0, len(chordTemplates))
+	for q := range chordTemplates {
+		qualities = append(qualities, q)
+	}
+	sort.Strings(qualities)
+	best, bestScore := NoChord, 0.0
+	for root := 0; root < 12; root++ {
+		for _, q := range qualities {
+			notes := chordTemplates[q]
+			dot := 0.0
+			for _, n := range notes {
+				dot += chroma[(root+n)%12]
+			}
+			score := dot / norm / math.Sqrt(float64(len(notes)))
+			if score > bestScore+1e-9 {
+				best, bestScore = ChordLabel(root, q), score
+			}
+		}
+	}
+	return best, bestScore
+}
+
+// DetectChords label every window of spectra, analysed every spacing, and
+// join windows of the same chord into events
+func DetectChords(spectra []map[string]float64, spacing time.Duration) []ChordEvent {
+	chromas := make([][12]float64, len(spectra))
+	energy := make([]float64, len(spectra))
+	maxEnergy := 0.0
+	for i, sp := range spectra {
+		chromas[i] = Chroma(sp)
+		for _, v := range chromas[i] {
+			energy[i] += v
+		}
+		maxEnergy = math.Max(maxEnergy, energy[i])
+	}
+	labels := make([]string, len(spectra))
+	for i := range spectra {
+		labels[i] = NoChord
+		if maxEnergy == 0 || energy[i] < chordMinEnergy*maxEnergy {
+			continue
+		}
+		if label, score := MatchChord(chromas[i]); score >= chordMinScore {
+			labels[i] = label
+		}
+	}
+
+	chords := []ChordEvent{}
+	for i := range labels {
+		label := smoothLabel(labels, i)
+		start := time.Duration(i) * spacing
+		if n := len(chords); n > 0 && chords[n-1].Label == label {
+			chords[n-1].End = start + spacing
+			continue
+		}
+		chords = append(chords, ChordEvent{Label: label, Start: start, End: start + spacing})
+	}
+	return chords
+}
+
+// most common label around window i, the label of i itself on a tie
+func smoothLabel(labels []string, i int) string {
+	from, to := i-chordSmoothFrames/2, i+chordSmoothFrames/2
+	if from < 0 {
+		from = 0
+	}
+	if to >= len(labels) {
+		to = len(labels) - 1
+	}
+	count := map[string]int{}
+	for _, label := range labels[from : to+1] {
+		count[label]++
+	}
+	best := labels[i]
+	for _, label := range labels[from : to+1] {
+		if count[label] > count[best] {
+			best = label
+		}
+	}
+	return best
+}
+
+// ChordAt return label of chord at time t
+func ChordAt(chords []ChordEvent, t time.Duration) string {
+	i := sort.Search(len(chords), func(i int) bool { return chords[i].End > t })
+	if i < len(chords) && chords[i].Start <= t {
+		return chords[i].Label
+	}
+	return NoChord
+}
+
+// WriteChords write chords as CSV, start and end in seconds
+func WriteChords(w io.Writer, chords []ChordEvent) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start", "end", "chord"})
+	for _, c := range chords {
+		cw.Write([]string{
+			fmt.Sprintf("%.3f", c.Start.Seconds()),
+			fmt.Sprintf("%.3f", c.End.Seconds()),
+			c.Label,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Chords detect chords in spectra of the first channel from AnalyseAll
+func (k *Keys) Chords() []ChordEvent {
+	k.dataMu.Lock()
+	defer k.dataMu.Unlock()
+	return DetectChords(FirstChannel(k.spectrum), k.spacing)
+}
+
+// SaveChords write chords detected in spectra from AnalyseAll to a CSV file
+func (k *Keys) SaveChords(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := WriteChords(f, k.Chords()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,85 @@
+package dft
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchChord(t *testing.T) {
+	tests := []struct {
+		notes []string
+		want  string
+	}{
+		{[]string{"C4", "E4", "G4"}, "C"},
+		{[]string{"A3", "C4", "E4"}, "Am"},
+		{[]string{"G3", "B3", "D4", "F4"}, "G7"},
+		{[]string{"F3", "A3", "C4", "E4"}, "Fmaj7"},
+		{[]string{"B3", "D4", "F4"}, "Bdim"},
+		{[]string{"D4", "G4", "A4"}, "Dsus4"},
+		{[]string{"Fs3", "As3", "Cs4"}, "F#"},
+	}
+	for _, tt := range tests {
+		sample := make([]float64, 8000)
+		for _, n := range tt.notes {
+			sample = combineNotes(sample, generateSin(NoteFreq[n], 8000, len(sample)))
+		}
+		got, score := MatchChord(Chroma(PianoDFT(sample, 8000)))
+		if got != tt.want {
+			t.Errorf("%v got %s (%.2f), want %s", tt.notes, got, score, tt.want)
+		}
+	}
+}
+
+func TestDetectChords(t *testing.T) {
+	frame := func(notes ...string) map[string]float64 {
+		sp := map[string]float64{}
+		for _, n := range notes {
+			sp[n] = 1
+		}
+		return sp
+	}
+	spectra := []map[string]float64{}
+	for i := 0; i < 10; i++ {
+		spectra = append(spectra, frame("C4", "E4", "G4"))
+	}
+	// a single wrong window is smoothed away
+	spectra[5] = frame("D4", "Fs4", "A4")
+	for i := 0; i < 10; i++ {
+		spectra = append(spectra, frame("A3", "C4", "E4"))
+	}
+	for i := 0; i < 5; i++ {
+		spectra = append(spectra, frame())
+	}
+	spacing := time.Millisecond * 100
+	chords := DetectChords(spectra, spacing)
+	want := []ChordEvent{
+		{"C", 0, time.Second},
+		{"Am", time.Second, time.Second * 2},
+		{NoChord, time.Second * 2, time.Millisecond * 2500},
+	}
+	if len(chords) != len(want) {
+		t.Fatalf("got %v, want %v", chords, want)
+	}
+	for i := range want {
+		if chords[i] != want[i] {
+			t.Errorf("got %v, want %v", chords[i], want[i])
+		}
+	}
+	if got := ChordAt(chords, time.Millisecond*1050); got != "Am" {
+		t.Errorf("at 1.05s got %s, want Am", got)
+	}
+	if got := ChordAt(chords, time.Second*3); got != NoChord {
+		t.Errorf("after end got %s, want %s", got, NoChord)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChords(&buf, chords); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "start,end,chord" || lines[2] != "1.000,2.000,Am" {
+		t.Errorf("got csv %q", buf.String())
+	}
+}
@@ -0,0 +1,150 @@
+package dft
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Constant-Q transform, using sparse spectral kernel as in
+// Brown and Puckette (1992), "An efficient algorithm for the calculation
+// of a constant Q transform".
+// Every bin has the same ratio of frequency to bandwidth, so bass bins use
+// long windows, and treble bins short windows.
+
+// kernel values smaller than this are dropped from the sparse kernel
+const cqtSparseThreshold = 0.0054
+
+type sparseBin struct {
+	index []int // index into FFT coefficients
+	value []complex128
+}
+
+type CQT struct {
+	sampleRate      int
+	binsPerSemitone int
+	tuning          Tuning
+	q               float64
+	fftLen          int
+	work            *sync.Pool  // of *fftWork
+	kernel          []sparseBin // len(noteName) * binsPerSemitone
+}
+
+// NewCQT create a constant-Q analyser with binsPerSemitone bins for every
+// key, centred on the key. filterScale (0,1] shorten every window by the
+// same ratio, trading frequency resolution for time resolution.
+func NewCQT(sampleRate, binsPerSemitone int, filterScale float64) *CQT {
+	if binsPerSemitone < 1 {
+		binsPerSemitone = 1
+	}
+	if filterScale <= 0 || filterScale > 1 {
+		filterScale = 1
+	}
+	c := &CQT{
+		sampleRate:      sampleRate,
+		binsPerSemitone: binsPerSemitone,
+		tuning:          EqualTuning,
+		q:               filterScale / (math.Pow(2, 1/(12*float64(binsPerSemitone))) - 1),
+	}
+	c.initKernel()
+	return c
+}
+
+// frequency of bin k, bins of a key are centred on the key frequency
+func (c *CQT) binFreq(k int) float64 {
+	b := float64(c.binsPerSemitone)
+	key := k / c.binsPerSemitone
+	offset := float64(k%c.binsPerSemitone) - (b-1)/2
+	return c.tuning.freq(key) * math.Pow(2, offset/(12*b))
+}
+
+// SetTuning rebuild kernel, it is slow
+func (c *CQT) SetTuning(t Tuning) {
+	c.tuning = t
+	c.initKernel()
+}
+
+// window length of bin k
+func (c *CQT) binLength(k int) int {
+	return int(math.Ceil(c.q * float64(c.sampleRate) / c.binFreq(k)))
+}
+
+func (c *CQT) initKernel() {
+	numBin := len(noteName) * c.binsPerSemitone
+	fftLen := 1
+	for fftLen < c.binLength(0) {
+		fftLen *= 2
+	}
+	c.fftLen = fftLen
+	c.work = newFFTPool(fftLen)
+	c.kernel = make([]sparseBin, numBin)
+
+	cfft := fourier.NewCmplxFFT(fftLen)
+	temporal := make([]complex128, fftLen)
+	var spectral []complex128
+	for k := 0; k < numBin; k++ {
+		n := c.binLength(k)
+		w := 2 * math.Pi * c.binFreq(k) / float64(c.sampleRate)
+		for i := range temporal {
+			temporal[i] = 0
+		}
+		// hamming window, normalised so a sine of amplitude A give A/2,
+		// same scale as PianoDFT
+		sum := 0.0
+		for i := 0; i < n; i++ {
+			sum += 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		}
+		for i := 0; i < n; i++ {
+			h := (0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(n-1))) / sum
+			temporal[i] = cmplx.Rect(h, w*float64(i))
+		}
+		spectral = cfft.Coefficients(spectral, temporal)
+		bin := sparseBin{}
+		// real input, positive frequencies is enough
+		for j := 0; j <= fftLen/2; j++ {
+			v := spectral[j] / complex(float64(fftLen), 0)
+			if cmplx.Abs(v)*float64(fftLen) < cqtSparseThreshold {
+				continue
+			}
+			bin.index = append(bin.index, j)
+			bin.value = append(bin.value, cmplx.Conj(v))
+		}
+		c.kernel[k] = bin
+	}
+}
+
+func (c *CQT) WindowSize() int {
+	return c.fftLen
+}
+
+func (c *CQT) SampleRate() int {
+	return c.sampleRate
+}
+
+// Analyse return magnitude of each key, the strongest of its bins
+func (c *CQT) Analyse(sample []float64) map[string]float64 {
+	w := c.work.Get().(*fftWork)
+	defer c.work.Put(w)
+	n := copy(w.frame, sample)
+	for i := n; i < len(w.frame); i++ {
+		w.frame[i] = 0
+	}
+	w.coeff = w.fft.Coefficients(w.coeff, w.frame)
+
+	noteValue := make(map[string]float64, len(noteName))
+	for i, key := range noteName {
+		v := 0.0
+		for b := 0; b < c.binsPerSemitone; b++ {
+			bin := c.kernel[i*c.binsPerSemitone+b]
+			sum := complex(0, 0)
+			for j, idx := range bin.index {
+				sum += w.coeff[idx] * bin.value[j]
+			}
+			v = math.Max(v, cmplx.Abs(sum))
+		}
+		noteValue[key] = v
+	}
+	return noteValue
+}
@@ -0,0 +1,29 @@
+package dft
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCQTStrongestKey(t *testing.T) {
+	for _, bins := range []int{1, 3} {
+		c := NewCQT(44100, bins, 1)
+		for _, note := range []string{"A1", "A4", "Cs7"} {
+			sample := generateSin(NoteFreq[note], 44100, c.WindowSize())
+			sp := c.Analyse(sample)
+			best := ""
+			for _, key := range noteName {
+				if best == "" || sp[key] > sp[best] {
+					best = key
+				}
+			}
+			if best != note {
+				t.Errorf("%d bins: want %s strongest, got %s", bins, note, best)
+			}
+			// sine of amplitude 1 has magnitude 0.5, same as PianoDFT
+			if math.Abs(sp[note]-0.5) > 0.05 {
+				t.Errorf("%d bins: %s magnitude %f, want 0.5", bins, note, sp[note])
+			}
+		}
+	}
+}
@@ -19,6 +19,11 @@ var keyPosLeft map[string]float64
 var keyPosMid map[string]float64
 var imageWidth int
 
+// key positions are needed without Keys too, e.g. to draw a loaded spectrum
+func init() {
+	initDraw()
+}
+
 func initDraw() {
 	keyPosLeft = make(map[string]float64)
 	keyPosMid = make(map[string]float64)
@@ -127,12 +132,14 @@ func DrawNewStripe(value map[string]float64, maxValue float64, height int) image
 func DrawSpectrum(s []map[string]float64, height int) image.Image {
 
 	imageHeight := len(s) * height
-	bg := DrawEmpty(imageHeight) // 10 pixel * num of strips
+	bg := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight)) // 10 pixel * num of strips
 
 	for i, spec := range s {
 		// log.Printf("inside drawingspectrum, %d, %f", i, spec["C4"])
-		img := DrawNewStripe(spec, 0.001, 10)
-		bg = DrawOnImage(bg, img, image.Point{0, imageHeight - ((i + 1) * 10)})
+		img := DrawNewStripe(spec, 0.001, height)
+		// draw in place, DrawOnImage copy the whole image for every strip
+		r := image.Rect(0, imageHeight-((i+1)*height), imageWidth, imageHeight-(i*height))
+		draw.Draw(bg, r, img, image.Point{}, draw.Src)
 		// err = Export(fmt.Sprintf("test%02d.png", i), img)
 		// if err != nil {
 		// 	t.Errorf("export png : %v", err)
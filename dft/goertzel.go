@@ -0,0 +1,109 @@
+package dft
+
+import (
+	"math"
+	"sync"
+)
+
+// Goertzel algorithm evaluate a single term of the DFT with one multiply
+// per sample, instead of a cmplx.Exp per sample as in NoteDFT.
+
+// number of wave cycles sampled for each key by PianoDFT
+const pianoCycles = 25
+
+// coefficients of one key at one sample rate
+type goertzelCoeff struct {
+	n       int     // number of samples in the number of waves
+	coeff   float64 // 2cos(w), w for n samples
+	partial float64 // 2cos(w), w for when sample is shorter than n
+}
+
+type goertzelCacheKey struct {
+	sampleRate int
+	cycles     float64
+	tuning     Tuning
+}
+
+var (
+	goertzelMu    sync.Mutex
+	goertzelCache = map[goertzelCacheKey][]goertzelCoeff{} // key in noteName order
+)
+
+// pianoCoeffs return coefficients for every key, computed once per sample
+// rate, number of wave cycles and tuning
+func pianoCoeffs(sampleRate int, cycles float64, t Tuning) []goertzelCoeff {
+	goertzelMu.Lock()
+	defer goertzelMu.Unlock()
+	ck := goertzelCacheKey{sampleRate, cycles, t}
+	if c, ok := goertzelCache[ck]; ok {
+		return c
+	}
+	c := make([]goertzelCoeff, len(noteName))
+	for i := range noteName {
+		freq := t.freq(i)
+		n := int(math.Floor(float64(sampleRate) * cycles / freq))
+		c[i] = goertzelCoeff{
+			n:       n,
+			coeff:   2 * math.Cos(2*math.Pi*cycles/float64(n)),
+			partial: 2 * math.Cos(2*math.Pi*freq/float64(sampleRate)),
+		}
+	}
+	goertzelCache[ck] = c
+	return c
+}
+
+// pianoGoertzel is PianoDFT with window w, window widen the main lobe,
+// so number of cycles is widen by the same ratio to keep neighbour keys
+// apart
+func pianoGoertzel(sample []float64, sampleRate int, w *Window, t Tuning) map[string]float64 {
+	noteValue := make(map[string]float64, len(noteName))
+	coeffs := pianoCoeffs(sampleRate, pianoCycles*w.lobe, t)
+	for i, key := range noteName {
+		c := coeffs[i]
+		// lack of sample at the end of file, use what we have
+		s, coeff := sample, c.partial
+		if c.n <= len(sample) {
+			s, coeff = sample[:c.n], c.coeff
+		}
+		if w.name == rectangular {
+			noteValue[key] = goertzel(s, coeff)
+		} else {
+			noteValue[key] = goertzelWindow(s, coeff, w.Coefficients(len(s)))
+		}
+	}
+	return noteValue
+}
+
+// goertzel return magnitude of the DFT term with coefficient 2cos(w),
+// normalised by number of sample, same scale as NoteDFT
+func goertzel(sample []float64, coeff float64) float64 {
+	if len(sample) == 0 {
+		return 0
+	}
+	var s1, s2 float64
+	for _, x := range sample {
+		s0 := x + coeff*s1 - s2
+		s2 = s1
+		s1 = s0
+	}
+	power := s1*s1 + s2*s2 - coeff*s1*s2
+	return math.Sqrt(math.Max(power, 0)) / float64(len(sample))
+}
+
+// goertzelWindow is goertzel with each sample weighted by window, and
+// normalised by sum of window, so a sine has the same magnitude under any
+// window
+func goertzelWindow(sample []float64, coeff float64, window []float64) float64 {
+	if len(sample) == 0 {
+		return 0
+	}
+	var s1, s2, sum float64
+	for i, x := range sample {
+		s0 := x*window[i] + coeff*s1 - s2
+		s2 = s1
+		s1 = s0
+		sum += window[i]
+	}
+	power := s1*s1 + s2*s2 - coeff*s1*s2
+	return math.Sqrt(math.Max(power, 0)) / sum
+}
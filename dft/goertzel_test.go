@@ -0,0 +1,45 @@
+package dft
+
+import (
+	"math"
+	"testing"
+)
+
+// 0.1 second of A4, C6 and A0 at 44100 Hz, the window size used by Keys
+func pianoTestSample() []float64 {
+	l := generateNote("A4", 44100, 16, 1)
+	l = combineNotes(l, generateNote("C6", 44100, 16, 1))
+	l = combineNotes(l, generateNote("A0", 44100, 16, 1))
+	return l[:4410]
+}
+
+func TestPianoDFTMatchesNoteDFT(t *testing.T) {
+	for _, sample := range [][]float64{
+		pianoTestSample(),
+		generateNote("As4", 44100, 16, 1), // long enough for every key
+	} {
+		got := PianoDFT(sample, 44100)
+		for _, key := range noteName {
+			want := NoteDFT(sample, key, 25, 44100)
+			if math.Abs(got[key]-want) > 1e-6*math.Max(1, want) {
+				t.Errorf("%s: want %f, got %f", key, want, got[key])
+			}
+		}
+	}
+}
+
+func BenchmarkNoteDFT(b *testing.B) {
+	sample := pianoTestSample()
+	for i := 0; i < b.N; i++ {
+		for _, key := range noteName {
+			NoteDFT(sample, key, 25, 44100)
+		}
+	}
+}
+
+func BenchmarkPianoDFT(b *testing.B) {
+	sample := pianoTestSample()
+	for i := 0; i < b.N; i++ {
+		PianoDFT(sample, 44100)
+	}
+}
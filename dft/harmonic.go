@@ -0,0 +1,131 @@
+package dft
+
+// Harmonic suppression. A played key also light up its octave, twelfth and
+// higher partials, these turn a spectrum into salience of each key, with
+// the partials of stronger keys taken away.
+
+import "fmt"
+
+// PostProcess transform the spectrum of each window, before it is drawn
+type PostProcess func(map[string]float64) map[string]float64
+
+// semitones above the fundamental of partials 2 to 8
+var partialSemitones = []int{12, 19, 24, 28, 31, 34, 36}
+
+const (
+	partialDecay    = 0.7  // magnitude of each partial relative to the one below
+	salienceMaxKeys = 10   // most keys found in one window
+	salienceMin     = 0.05 // stop when strongest key left is below this ratio
+	whitenKeys      = 6    // keys each side used as local mean by whitening
+)
+
+// names accepted by NewPostProcess
+var PostProcessNames = []string{"none", "subtract", "whiten"}
+
+// NewPostProcess return post process by name, nil for none
+func NewPostProcess(name string) (PostProcess, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "subtract":
+		return SuppressHarmonics, nil
+	case "whiten":
+		return WhitenSalience, nil
+	}
+	return nil, fmt.Errorf("unknown post process %q", name)
+}
+
+// SuppressHarmonics estimate keys one by one, the key with most energy at
+// its partials is taken, and its expected partials subtracted from the
+// rest, until nothing strong is left
+func SuppressHarmonics(spectrum map[string]float64) map[string]float64 {
+	values := make([]float64, len(noteName))
+	weights := make([]float64, len(noteName))
+	for i, key := range noteName {
+		values[i] = spectrum[key]
+		weights[i] = 1
+	}
+	return toSpectrum(harmonicSubtraction(values, weights))
+}
+
+// WhitenSalience is SuppressHarmonics on a whitened spectrum, each key is
+// divided by the mean of its neighbours, so quiet treble keys are not
+// buried under the bass. Partials are still subtracted from the raw
+// magnitude, whitening would distort their ratios.
+func WhitenSalience(spectrum map[string]float64) map[string]float64 {
+	values := make([]float64, len(noteName))
+	weights := make([]float64, len(noteName))
+	for i := range noteName {
+		values[i] = spectrum[noteName[i]]
+		sum, count := 0.0, 0
+		for j := i - whitenKeys; j <= i+whitenKeys; j++ {
+			if j >= 0 && j < len(noteName) {
+				sum += spectrum[noteName[j]]
+				count++
+			}
+		}
+		mean := sum / float64(count)
+		if mean > 0 {
+			weights[i] = 1 / mean
+		}
+	}
+	return toSpectrum(harmonicSubtraction(values, weights))
+}
+
+// harmonicSubtraction take keys by harmonic sum of residual scaled by
+// weights, salience of a key is its weighted magnitude
+func harmonicSubtraction(residual, weights []float64) []float64 {
+	salience := make([]float64, len(residual))
+	max := 0.0
+	for i, v := range residual {
+		if v*weights[i] > max {
+			max = v * weights[i]
+		}
+	}
+	for n := 0; n < salienceMaxKeys; n++ {
+		best, bestScore := -1, 0.0
+		for i, v := range residual {
+			if v*weights[i] < max*salienceMin {
+				continue
+			}
+			// harmonic sum
+			score, weight := v*weights[i], 1.0
+			for _, s := range partialSemitones {
+				weight *= partialDecay
+				if i+s < len(residual) {
+					score += weight * residual[i+s] * weights[i+s]
+				}
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a := residual[best]
+		salience[best] = a * weights[best]
+		residual[best] = 0
+		weight := 1.0
+		for _, s := range partialSemitones {
+			weight *= partialDecay
+			j := best + s
+			if j >= len(residual) {
+				break
+			}
+			residual[j] -= a * weight
+			if residual[j] < 0 {
+				residual[j] = 0
+			}
+		}
+	}
+	return salience
+}
+
+func toSpectrum(values []float64) map[string]float64 {
+	sp := make(map[string]float64, len(noteName))
+	for i, key := range noteName {
+		sp[key] = values[i]
+	}
+	return sp
+}
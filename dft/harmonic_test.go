@@ -0,0 +1,40 @@
+package dft
+
+import (
+	"math"
+	"testing"
+)
+
+// note with partials 2 to 8, each partialDecay of the one below
+func generatePartials(note string, sampleRate, sampleSize int) []float64 {
+	sample := make([]float64, sampleSize)
+	a := 1.0
+	for h := 1; h <= 8; h++ {
+		p := generateSin(NoteFreq[note]*float64(h), sampleRate, sampleSize)
+		for i := range sample {
+			sample[i] += a * p[i]
+		}
+		a *= partialDecay
+	}
+	return sample
+}
+
+func TestSuppressHarmonics(t *testing.T) {
+	sample := combineNotes(generatePartials("A3", 44100, 44100), generatePartials("F4", 44100, 44100))
+	raw := PianoDFT(sample, 44100)
+	if raw["A4"] < 0.3*raw["A3"] {
+		t.Fatalf("expect octave of A3 in raw spectrum, A3 %f, A4 %f", raw["A3"], raw["A4"])
+	}
+	for _, name := range PostProcessNames[1:] {
+		post, _ := NewPostProcess(name)
+		sp := post(raw)
+		for _, key := range []string{"A4", "E5", "A5", "F5", "C6"} {
+			if sp[key] > 0.05*math.Min(sp["A3"], sp["F4"]) {
+				t.Errorf("%s: partial %s not suppressed, %f", name, key, sp[key])
+			}
+		}
+		if sp["A3"] == 0 || sp["F4"] == 0 {
+			t.Errorf("%s: lost played keys, A3 %f, F4 %f", name, sp["A3"], sp["F4"])
+		}
+	}
+}
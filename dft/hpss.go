@@ -0,0 +1,133 @@
+package dft
+
+// Harmonic/percussive separation by median filtering, as in Fitzgerald
+// (2010), "Harmonic/percussive separation using median filtering".
+// On a spectrogram, pitched notes are horizontal lines and drums are
+// vertical lines. A median along time keep the first, a median along
+// frequency keep the second, and the ratio of the two is a mask.
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+	"sync"
+)
+
+// Preprocessor transform samples before they are analysed, it need
+// Context samples each side of a window to do so
+type Preprocessor interface {
+	Context() int
+	// return signal of the same length, may be called from several
+	// goroutines at once
+	Process(signal []float64) []float64
+}
+
+const (
+	hpssTimeMedian = 17 // frames in median along time
+	hpssFreqMedian = 17 // bins in median along frequency
+	hpssMaskPower  = 2  // soft mask, Wiener filter
+)
+
+// HPSS keep the harmonic part of a signal
+type HPSS struct {
+	frameSize int
+	hop       int
+	window    []float64 // hann
+	work      *sync.Pool
+}
+
+// NewHPSS create separation with STFT frames of about 23ms
+func NewHPSS(sampleRate int) *HPSS {
+	frameSize := 1
+	for frameSize < sampleRate/43 {
+		frameSize *= 2
+	}
+	return &HPSS{
+		frameSize: frameSize,
+		hop:       frameSize / 4,
+		window:    Hann().Coefficients(frameSize),
+		work:      newFFTPool(frameSize),
+	}
+}
+
+// Context return samples needed each side of a window, for the median
+// along time to be complete
+func (h *HPSS) Context() int {
+	return (hpssTimeMedian/2+1)*h.hop + h.frameSize
+}
+
+// Process return harmonic part of signal
+func (h *HPSS) Process(signal []float64) []float64 {
+	out := make([]float64, len(signal))
+	if len(signal) == 0 {
+		return out
+	}
+	w := h.work.Get().(*fftWork)
+	defer h.work.Put(w)
+
+	// STFT, first frame centred on the first sample
+	numBin := h.frameSize/2 + 1
+	numFrame := len(signal)/h.hop + 1
+	stft := make([][]complex128, numFrame)
+	mag := make([][]float64, numFrame)
+	for t := range stft {
+		pos := t*h.hop - h.frameSize/2
+		for i := range w.frame {
+			w.frame[i] = 0
+			if j := pos + i; j >= 0 && j < len(signal) {
+				w.frame[i] = signal[j] * h.window[i]
+			}
+		}
+		stft[t] = w.fft.Coefficients(nil, w.frame)
+		mag[t] = make([]float64, numBin)
+		for f, c := range stft[t] {
+			mag[t][f] = cmplx.Abs(c)
+		}
+	}
+
+	// mask, then overlap add the harmonic frames
+	norm := make([]float64, len(signal))
+	buf := make([]float64, hpssTimeMedian+hpssFreqMedian)
+	for t := range stft {
+		for f := range stft[t] {
+			harmonic := median(buf[:0], mag, t-hpssTimeMedian/2, t+hpssTimeMedian/2, f, f)
+			percussive := median(buf[:0], mag, t, t, f-hpssFreqMedian/2, f+hpssFreqMedian/2)
+			hp := math.Pow(harmonic, hpssMaskPower)
+			pp := math.Pow(percussive, hpssMaskPower)
+			if hp+pp > 0 {
+				stft[t][f] *= complex(hp/(hp+pp), 0)
+			}
+		}
+		w.frame = w.fft.Sequence(w.frame, stft[t])
+		pos := t*h.hop - h.frameSize/2
+		for i, v := range w.frame {
+			if j := pos + i; j >= 0 && j < len(signal) {
+				// Sequence is not normalised
+				out[j] += v / float64(h.frameSize) * h.window[i]
+				norm[j] += h.window[i] * h.window[i]
+			}
+		}
+	}
+	for i := range out {
+		if norm[i] > 1e-6 {
+			out[i] /= norm[i]
+		}
+	}
+	return out
+}
+
+// median of mag in frames t0 to t1 and bins f0 to f1, clipped at edges
+func median(buf []float64, mag [][]float64, t0, t1, f0, f1 int) float64 {
+	for t := t0; t <= t1; t++ {
+		if t < 0 || t >= len(mag) {
+			continue
+		}
+		for f := f0; f <= f1; f++ {
+			if f >= 0 && f < len(mag[t]) {
+				buf = append(buf, mag[t][f])
+			}
+		}
+	}
+	sort.Float64s(buf)
+	return buf[len(buf)/2]
+}
@@ -0,0 +1,90 @@
+package dft
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHPSS(t *testing.T) {
+	sampleRate := 8000
+	tone := generateSin(NoteFreq["A4"], sampleRate, sampleRate)
+	clicks := make([]float64, len(tone))
+	for i := 500; i < len(clicks); i += 2000 {
+		clicks[i] = 20
+	}
+	signal := combineNotes(tone, clicks)
+	h := NewHPSS(sampleRate)
+	harmonic := h.Process(signal)
+	if len(harmonic) != len(signal) {
+		t.Fatalf("got %d samples, want %d", len(harmonic), len(signal))
+	}
+	// away from the edges, harmonic part is the tone without the clicks
+	errTone, errSignal := 0.0, 0.0
+	for i := h.frameSize; i < len(signal)-h.frameSize; i++ {
+		errTone += math.Pow(harmonic[i]-tone[i], 2)
+		errSignal += math.Pow(signal[i]-tone[i], 2)
+	}
+	if errTone > 0.1*errSignal {
+		t.Errorf("clicks left in harmonic part, error %f, before %f", errTone, errSignal)
+	}
+	// the tone itself is kept
+	sp := PianoDFT(harmonic[2000:2800], sampleRate)
+	want := PianoDFT(tone[2000:2800], sampleRate)
+	if sp["A4"] < 0.8*want["A4"] {
+		t.Errorf("A4 got %f, want %f", sp["A4"], want["A4"])
+	}
+}
+
+func TestKeysPreprocess(t *testing.T) {
+	sampleRate := 8000
+	tone := generateSin(NoteFreq["A4"], sampleRate, sampleRate*3)
+	clicked := append([]float64(nil), tone...)
+	for i := 500; i < len(clicked); i += 2000 {
+		clicked[i] += 20
+	}
+	// energy of every key but A4, in each window
+	others := func(k *Keys) []float64 {
+		sum := []float64{}
+		k.AnalyseParallel(context.Background(), 0, 2, func(i int, sp []map[string]float64) error {
+			s := 0.0
+			for key, v := range sp[0] {
+				if key != "A4" {
+					s += v
+				}
+			}
+			sum = append(sum, s)
+			// same as analysed one by one
+			if seq := k.Analyse(time.Duration(i) * k.Spacing()); math.Abs(seq["A4"]-sp[0]["A4"]) > 0.01 {
+				t.Errorf("window %d A4 got %f, one by one %f", i, sp[0]["A4"], seq["A4"])
+			}
+			return nil
+		})
+		return sum
+	}
+	newKeys := func(data []float64, pre Preprocessor) *Keys {
+		k := newTestKeys(data, sampleRate)
+		k.SetSpacing(time.Millisecond * 100)
+		k.SetPreprocess(pre)
+		return k
+	}
+	// other keys of a tone alone are leakage of A4
+	base := others(newKeys(tone, nil))
+	before := others(newKeys(clicked, nil))
+	after := others(newKeys(clicked, NewHPSS(sampleRate)))
+	clicks := 0
+	for i := range before {
+		if before[i]-base[i] < 0.1 {
+			// no click in window
+			continue
+		}
+		clicks++
+		if math.Abs(after[i]-base[i]) > 0.3*(before[i]-base[i]) {
+			t.Errorf("window %d other keys %f, before %f, tone alone %f", i, after[i], before[i], base[i])
+		}
+	}
+	if clicks == 0 {
+		t.Error("no window with click")
+	}
+}
@@ -0,0 +1,147 @@
+package dft
+
+// Key detection, Krumhansl-Schmuckler. Chroma of the whole file is
+// correlated with a profile of how much each pitch class is heard in a
+// major or minor key, rotated to every tonic.
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Krumhansl and Kessler (1982) probe tone profiles, from the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// semitones above the tonic, natural minor
+var (
+	majorScale = []int{0, 2, 4, 5, 7, 9, 11}
+	minorScale = []int{0, 2, 3, 5, 7, 8, 10}
+)
+
+// MusicKey is the key of a piece, e.g. D minor
+type MusicKey struct {
+	Tonic int // pitch class, C is 0
+	Minor bool
+	Score float64 // correlation with the key profile, -1 to 1
+}
+
+func (m MusicKey) String() string {
+	mode := "major"
+	if m.Minor {
+		mode = "minor"
+	}
+	return fmt.Sprintf("%s %s", strings.Replace(PitchClassNames[m.Tonic], "s", "#", 1), mode)
+}
+
+// InScale is true when key, e.g. "Fs4", is in the scale of m
+func (m MusicKey) InScale(key string) bool {
+	i, ok := noteIndex[key]
+	if !ok {
+		return false
+	}
+	scale := majorScale
+	if m.Minor {
+		scale = minorScale
+	}
+	pc := (i + 9) % 12 // noteName start at A
+	for _, s := range scale {
+		if (m.Tonic+s)%12 == pc {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectKey estimate key of spectra of a whole file, each window count the
+// same, so loud passages do not decide alone. ok is false when there is no
+// key to tell, e.g. silence.
+func DetectKey(spectra []map[string]float64) (m MusicKey, ok bool) {
+	var chroma [12]float64
+	for _, sp := range spectra {
+		c := Chroma(sp)
+		sum := 0.0
+		for _, v := range c {
+			sum += v
+		}
+		if sum == 0 {
+			continue
+		}
+		for i := range chroma {
+			chroma[i] += c[i] / sum
+		}
+	}
+	best := MusicKey{Score: math.Inf(-1)}
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, minor := range []bool{false, true} {
+			profile := majorProfile
+			if minor {
+				profile = minorProfile
+			}
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[(tonic+i)%12] = profile[i]
+			}
+			if r := correlation(chroma, rotated); r > best.Score {
+				best = MusicKey{Tonic: tonic, Minor: minor, Score: r}
+			}
+		}
+	}
+	// no window with sound, or every pitch class the same
+	if best.Score <= 0 {
+		return MusicKey{}, false
+	}
+	return best, true
+}
+
+// Pearson correlation
+func correlation(a, b [12]float64) float64 {
+	meanA, meanB := 0.0, 0.0
+	for i := range a {
+		meanA += a[i] / 12
+		meanB += b[i] / 12
+	}
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// MusicKey estimate key from spectra of the first channel from AnalyseAll,
+// ok is false when there is no key to tell
+func (k *Keys) MusicKey() (MusicKey, bool) {
+	k.dataMu.Lock()
+	defer k.dataMu.Unlock()
+	return DetectKey(FirstChannel(k.spectrum))
+}
+
+// DrawScale mark keys in the scale of m, to lay over the keyboard, the
+// tonic is marked stronger
+func DrawScale(m MusicKey, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, height))
+	for i, k := range noteName {
+		if !m.InScale(k) {
+			continue
+		}
+		colour := color.NRGBA{0, 200, 80, 90}
+		if (i+9)%12 == m.Tonic {
+			colour.A = 180
+		}
+		x := keyPosMid[k] * float64(imageWidth)
+		b := image.Rect(int(x)-5, 0, int(x)+5, height)
+		draw.Draw(img, b, &image.Uniform{colour}, image.Point{}, draw.Over)
+	}
+	return img
+}
@@ -0,0 +1,45 @@
+package dft
+
+import "testing"
+
+func TestDetectKey(t *testing.T) {
+	frame := func(notes ...string) map[string]float64 {
+		sp := map[string]float64{}
+		for _, n := range notes {
+			sp[n] = 1
+		}
+		return sp
+	}
+	// i iv V i in D minor, and I IV V I in A major
+	tests := []struct {
+		spectra []map[string]float64
+		want    string
+	}{
+		{[]map[string]float64{
+			frame("D3", "F4", "A4"), frame("G3", "As4", "D5"),
+			frame("A3", "Cs4", "E4"), frame("D3", "F4", "A4", "D4"),
+		}, "D minor"},
+		{[]map[string]float64{
+			frame("A3", "Cs4", "E4"), frame("D3", "Fs4", "A4"),
+			frame("E3", "Gs4", "B4"), frame("A3", "Cs4", "E4", "A4"),
+		}, "A major"},
+	}
+	for _, tt := range tests {
+		if got, ok := DetectKey(tt.spectra); !ok || got.String() != tt.want {
+			t.Errorf("got %s %v, want %s", got, ok, tt.want)
+		}
+	}
+	// nothing, and silence
+	for _, spectra := range [][]map[string]float64{nil, {{}, {}}} {
+		if got, ok := DetectKey(spectra); ok {
+			t.Errorf("no key in %d windows, got %s", len(spectra), got)
+		}
+	}
+
+	d := MusicKey{Tonic: 2, Minor: true}
+	for key, want := range map[string]bool{"D4": true, "F2": true, "As3": true, "Fs4": false, "B5": false} {
+		if got := d.InScale(key); got != want {
+			t.Errorf("%s in D minor got %v, want %v", key, got, want)
+		}
+	}
+}
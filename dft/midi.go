@@ -0,0 +1,168 @@
+package dft
+
+import (
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"iatearock.com/musicroll/midi"
+)
+
+// MIDI note number of A0, the first key
+const midiKeyA0 = 21
+
+type MIDIOptions struct {
+	Format int     // 0 single track, 1 tempo track and note track
+	PPQ    int     // ticks per quarter note
+	Tempo  float64 // beats per minute
+}
+
+var DefaultMIDIOptions = MIDIOptions{Format: 1, PPQ: 480, Tempo: 120}
+
+// KeyNumber return MIDI note number of key, -1 for unknown key
+func KeyNumber(key string) int {
+	i, ok := noteIndex[key]
+	if !ok {
+		return -1
+	}
+	return i + midiKeyA0
+}
+
+// KeyName return key of MIDI note number, "" outside the 88 keys
+func KeyName(number int) string {
+	i := number - midiKeyA0
+	if i < 0 || i >= len(noteName) {
+		return ""
+	}
+	return noteName[i]
+}
+
+// NotesToMIDI put notes in a MIDI file, at a constant tempo
+func NotesToMIDI(notes []NoteEvent, opts MIDIOptions) *midi.File {
+	ticks := func(d time.Duration) int {
+		return int(math.Round(d.Minutes() * opts.Tempo * float64(opts.PPQ)))
+	}
+	tempo := midi.Track{midi.Tempo(0, opts.Tempo)}
+	track := midi.Track{midi.TrackName(0, "musicroll")}
+	for _, n := range notes {
+		key := KeyNumber(n.Key)
+		if key < 0 {
+			continue
+		}
+		velocity := byte(1 + math.Round(math.Min(math.Max(n.Velocity, 0), 1)*126))
+		track = append(track,
+			midi.NoteOn(ticks(n.Onset), 0, byte(key), velocity),
+			midi.NoteOff(ticks(n.Offset), 0, byte(key)))
+	}
+	f := &midi.File{Format: opts.Format, Division: opts.PPQ}
+	if opts.Format == 0 {
+		f.Tracks = []midi.Track{append(tempo, track...)}
+	} else {
+		f.Tracks = []midi.Track{tempo, track}
+	}
+	return f
+}
+
+// SaveMIDI write notes detected in spectra from AnalyseAll to a MIDI file
+func (k *Keys) SaveMIDI(name string, seg SegmentOptions, opts MIDIOptions) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return midi.Write(f, NotesToMIDI(k.Notes(seg), opts))
+}
+
+// NotesFromMIDI read notes of every track, ticks are turned into time
+// with the tempo changes of the file
+func NotesFromMIDI(f *midi.File) []NoteEvent {
+	// tempo map, from all tracks, default 120 bpm
+	type tempoChange struct {
+		tick int
+		bpm  float64
+	}
+	tempos := []tempoChange{{0, 120}}
+	for _, t := range f.Tracks {
+		for _, e := range t {
+			if bpm := e.BPM(); bpm > 0 {
+				tempos = append(tempos, tempoChange{e.Tick, bpm})
+			}
+		}
+	}
+	sort.SliceStable(tempos, func(i, j int) bool { return tempos[i].tick < tempos[j].tick })
+	toTime := func(tick int) time.Duration {
+		var d float64 // minutes
+		for i, t := range tempos {
+			if t.tick >= tick {
+				break
+			}
+			end := tick
+			if i+1 < len(tempos) && tempos[i+1].tick < tick {
+				end = tempos[i+1].tick
+			}
+			d += float64(end-t.tick) / float64(f.Division) / t.bpm
+		}
+		return time.Duration(d * float64(time.Minute))
+	}
+
+	notes := []NoteEvent{}
+	for _, t := range f.Tracks {
+		// note on waiting for note off, by channel and key
+		playing := map[[2]byte][]midi.Event{}
+		for _, e := range t {
+			key, _ := e.Note()
+			id := [2]byte{e.Status & 0x0F, key}
+			switch {
+			case e.IsNoteOn():
+				playing[id] = append(playing[id], e)
+			case e.IsNoteOff() && len(playing[id]) > 0:
+				on := playing[id][0]
+				playing[id] = playing[id][1:]
+				_, velocity := on.Note()
+				if name := KeyName(int(key)); name != "" {
+					notes = append(notes, NoteEvent{
+						Key:      name,
+						Onset:    toTime(on.Tick),
+						Offset:   toTime(e.Tick),
+						Velocity: float64(velocity) / 127,
+					})
+				}
+			}
+		}
+	}
+	sortNotes(notes)
+	return notes
+}
+
+// LoadMIDI read notes from a MIDI file
+func LoadMIDI(path string) ([]NoteEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := midi.Read(f)
+	if err != nil {
+		return nil, err
+	}
+	return NotesFromMIDI(m), nil
+}
+
+// NotesToSpectra turn notes into one spectrum every spacing for length,
+// same number of spectra as analysing a file of that length, so notes can
+// be drawn like an analysis. A key has the velocity of its note.
+func NotesToSpectra(notes []NoteEvent, spacing, length time.Duration) []map[string]float64 {
+	spectra := make([]map[string]float64, int(length/spacing)+1)
+	for i := range spectra {
+		spectra[i] = map[string]float64{}
+	}
+	for _, n := range notes {
+		first := int(n.Onset / spacing)
+		last := int((n.Offset - 1) / spacing)
+		for i := first; i <= last && i < len(spectra); i++ {
+			spectra[i][n.Key] = math.Max(spectra[i][n.Key], n.Velocity)
+		}
+	}
+	return spectra
+}
@@ -0,0 +1,87 @@
+package dft
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"iatearock.com/musicroll/midi"
+)
+
+func TestNotesToMIDI(t *testing.T) {
+	notes := []NoteEvent{
+		{"A0", 0, time.Second, 1},
+		{"C4", time.Millisecond * 500, time.Millisecond * 750, 0.5},
+		{"C8", time.Second, time.Second * 2, 0},
+	}
+	for _, format := range []int{0, 1} {
+		opts := MIDIOptions{Format: format, PPQ: 96, Tempo: 90}
+		var buf bytes.Buffer
+		if err := midi.Write(&buf, NotesToMIDI(notes, opts)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := midi.Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		track := f.Tracks[len(f.Tracks)-1]
+		// 90 bpm, 96 ppq is 144 ticks per second
+		want := []struct {
+			tick     int
+			on       bool
+			key, vel byte
+		}{
+			{0, true, 21, 127}, {72, true, 60, 64}, {108, false, 60, 0},
+			{144, false, 21, 0}, {144, true, 108, 1}, {288, false, 108, 0},
+		}
+		got := []midi.Event{}
+		for _, e := range track {
+			if e.IsNoteOn() || e.IsNoteOff() {
+				got = append(got, e)
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("format %d: want %d note events, got %v", format, len(want), got)
+		}
+		for i, w := range want {
+			key, vel := got[i].Note()
+			if got[i].Tick != w.tick || got[i].IsNoteOn() != w.on || key != w.key || (w.on && vel != w.vel) {
+				t.Errorf("format %d event %d: want %v, got %v", format, i, w, got[i])
+			}
+		}
+	}
+}
+
+func TestNotesFromMIDI(t *testing.T) {
+	// 120 bpm for 2 beats, then 60 bpm
+	tempo := midi.Track{midi.Tempo(0, 120), midi.Tempo(960, 60)}
+	track := midi.Track{
+		midi.NoteOn(0, 0, 69, 127),
+		midi.NoteOn(480, 0, 69, 127), // played again before off
+		midi.NoteOff(960, 0, 69),
+		midi.NoteOff(1440, 0, 69),
+		midi.NoteOn(1440, 9, 20, 64), // below A0
+		midi.NoteOff(1500, 9, 20),
+	}
+	notes := NotesFromMIDI(&midi.File{Format: 1, Division: 480, Tracks: []midi.Track{tempo, track}})
+	want := []NoteEvent{
+		{"A4", 0, time.Second, 1},
+		{"A4", time.Millisecond * 500, time.Second * 2, 1},
+	}
+	if len(notes) != len(want) {
+		t.Fatalf("want %v, got %v", want, notes)
+	}
+	for i := range want {
+		if notes[i] != want[i] {
+			t.Errorf("want %v, got %v", want[i], notes[i])
+		}
+	}
+
+	spectra := NotesToSpectra(notes, time.Millisecond*100, time.Second*3)
+	if len(spectra) != 31 {
+		t.Errorf("want 31 spectra, got %d", len(spectra))
+	}
+	if spectra[19]["A4"] != 1 || spectra[20]["A4"] != 0 {
+		t.Errorf("A4 should end at 2 seconds")
+	}
+}
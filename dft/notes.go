@@ -8,6 +8,7 @@ import (
 var noteName []string
 var NoteFreq map[string]float64 // node frequency
 var NoteCycle map[string]int    // number of wave cycle to be sample
+var noteIndex map[string]int    // index of key in noteName
 
 func init() {
 	noteName = []string{"A0", "As0", "B0",
@@ -20,6 +21,10 @@ func init() {
 		"C7", "Cs7", "D7", "Ds7", "E7", "F7", "Fs7", "G7", "Gs7", "A7", "As7", "B7",
 		"C8",
 	}
+	noteIndex = make(map[string]int)
+	for i, n := range noteName {
+		noteIndex[n] = i
+	}
 	NoteFreq = make(map[string]float64)
 	for i, n := range noteName {
 		num := float64(i + 1)
@@ -46,7 +51,11 @@ func SampleSize(sampleRate int, freq float64, cycle int) int {
 // of sample, in the k mode. (actual sample length use adjusted by
 // the k mode used, if k=3, then wavelength x 3 sample size used
 func NoteDFT(sample []float64, note string, k float64, sampleRate int) float64 {
-	freq := NoteFreq[note]
+	return freqDFT(sample, NoteFreq[note], k, sampleRate)
+}
+
+// freqDFT is NoteDFT by frequency instead of note name
+func freqDFT(sample []float64, freq float64, k float64, sampleRate int) float64 {
 	// NFloat := wavelength / (1 / float64(sampleRate)) * k
 	NSample := int(math.Floor(float64(sampleRate) * k / freq)) // number of samples in k number of wave
 	// math.Min - so we can accept lack of sample at the end of file
@@ -57,7 +66,7 @@ func NoteDFT(sample []float64, note string, k float64, sampleRate int) float64 {
 	// log.Printf("nSample %d, k %f", NSample, k)
 	if NSample > len(sample) {
 		NSample = len(sample)
-		k = numWave(NSample, note, sampleRate)
+		k = float64(NSample) / (float64(sampleRate) / freq)
 	}
 
 	// Euler formula
@@ -70,23 +79,21 @@ func NoteDFT(sample []float64, note string, k float64, sampleRate int) float64 {
 	return cmplx.Abs(sum) / float64(NSample)
 }
 
+// PianoDFT return magnitude of each of the 88 keys, same result as calling
+// NoteDFT with 25 cycles on every key, but computed with Goertzel algorithm
 func PianoDFT(sample []float64, sampleRate int) map[string]float64 {
-	noteValue := map[string]float64{}
-	// nCycle := float64(len(sample)) / (float64(sampleRate) / NoteFreq["A0"])
-	for _, key := range noteName {
-		v := NoteDFT(sample, key, 25, sampleRate)
-		// v := NoteDFT(sample, key, NoteCycle[key], sampleRate)
-		// v := NoteDFT(sample, key, nCycle, sampleRate)
-		noteValue[key] = v
-	}
-	return noteValue
+	return pianoGoertzel(sample, sampleRate, rectangularWindow, EqualTuning)
+}
+
+// PianoDFTWindow is PianoDFT with window function w applied to the samples
+// of every key
+func PianoDFTWindow(sample []float64, sampleRate int, w *Window) map[string]float64 {
+	return pianoGoertzel(sample, sampleRate, w, EqualTuning)
 }
 
-// Number of wave that can fit in the sample for a note
-func numWave(sampleSize int, note string, sampleRate int) float64 {
-	freq := NoteFreq[note]
-	samplePerWave := float64(sampleRate) / freq
-	return float64(sampleSize) / samplePerWave
+// PianoDFTTuned is PianoDFTWindow with key frequencies from tuning t
+func PianoDFTTuned(sample []float64, sampleRate int, w *Window, t Tuning) map[string]float64 {
+	return pianoGoertzel(sample, sampleRate, w, t)
 }
 
 // ============== FFT =================
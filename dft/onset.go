@@ -0,0 +1,168 @@
+package dft
+
+// Turn the spectra of a file into notes. Onsets are found by spectral
+// flux, each key is on between a high and a low threshold (hysteresis),
+// and a note is played again when there is an onset while the key rise.
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type NoteEvent struct {
+	Key      string
+	Onset    time.Duration
+	Offset   time.Duration
+	Velocity float64 // 0 to 1, peak magnitude relative to the loudest key in file
+}
+
+type SegmentOptions struct {
+	On          float64       // key turn on above this ratio of the loudest magnitude
+	Off         float64       // key turn off below this ratio
+	MinDuration time.Duration // shorter notes are dropped
+	OnsetDelta  float64       // onset when flux is above its local median by this ratio of max flux
+}
+
+var DefaultSegmentOptions = SegmentOptions{
+	On:          0.2,
+	Off:         0.1,
+	MinDuration: time.Millisecond * 100,
+	OnsetDelta:  0.05,
+}
+
+const (
+	fluxCompression   = 100 // log compression of magnitude before flux
+	onsetPeakFrames   = 1   // onset is the largest flux within this many frames
+	onsetMedianFrames = 4   // frames before the onset used as local median
+)
+
+// SpectralFlux return sum of log compressed increase over all keys, for
+// every spectrum compared with the one before
+func SpectralFlux(spectra []map[string]float64) []float64 {
+	max := maxMagnitude(spectra)
+	flux := make([]float64, len(spectra))
+	if max == 0 {
+		return flux
+	}
+	for i := 1; i < len(spectra); i++ {
+		for _, key := range noteName {
+			a := math.Log1p(fluxCompression * spectra[i-1][key] / max)
+			b := math.Log1p(fluxCompression * spectra[i][key] / max)
+			if b > a {
+				flux[i] += b - a
+			}
+		}
+	}
+	return flux
+}
+
+// Onsets return index of spectra where a note start, peak picking on flux
+// above a local median
+func Onsets(flux []float64, delta float64) []int {
+	maxFlux := 0.0
+	for _, f := range flux {
+		maxFlux = math.Max(maxFlux, f)
+	}
+	onsets := []int{}
+	for i, f := range flux {
+		if f == 0 {
+			continue
+		}
+		peak := true
+		for j := i - onsetPeakFrames; j <= i+onsetPeakFrames; j++ {
+			if j >= 0 && j < len(flux) && flux[j] > f {
+				peak = false
+			}
+		}
+		// median, so a loud onset nearby does not hide this one
+		local := []float64{}
+		for j := i - onsetMedianFrames; j <= i+onsetPeakFrames; j++ {
+			if j >= 0 && j < len(flux) {
+				local = append(local, flux[j])
+			}
+		}
+		sort.Float64s(local)
+		median := local[len(local)/2]
+		if len(local)%2 == 0 {
+			median = (local[len(local)/2-1] + median) / 2
+		}
+		if peak && f >= median+delta*maxFlux {
+			onsets = append(onsets, i)
+		}
+	}
+	return onsets
+}
+
+// DetectNotes segment spectra, analysed every spacing, into notes. Notes
+// are in order of onset.
+func DetectNotes(spectra []map[string]float64, spacing time.Duration, opts SegmentOptions) []NoteEvent {
+	max := maxMagnitude(spectra)
+	if max == 0 {
+		return []NoteEvent{}
+	}
+	isOnset := make([]bool, len(spectra))
+	for _, i := range Onsets(SpectralFlux(spectra), opts.OnsetDelta) {
+		isOnset[i] = true
+	}
+
+	notes := []NoteEvent{}
+	for _, key := range noteName {
+		start, peak := -1, 0.0
+		end := func(i int) {
+			n := NoteEvent{
+				Key:      key,
+				Onset:    time.Duration(start) * spacing,
+				Offset:   time.Duration(i) * spacing,
+				Velocity: peak,
+			}
+			if n.Offset-n.Onset >= opts.MinDuration {
+				notes = append(notes, n)
+			}
+			start, peak = -1, 0
+		}
+		prev := 0.0
+		for i, sp := range spectra {
+			v := sp[key] / max
+			switch {
+			case start < 0 && v > opts.On:
+				start = i
+			case start >= 0 && v < opts.Off:
+				end(i)
+			case start >= 0 && isOnset[i] && v-prev > opts.On:
+				// played again while still sounding
+				end(i)
+				start = i
+			}
+			if start >= 0 {
+				peak = math.Max(peak, v)
+			}
+			prev = v
+		}
+		if start >= 0 {
+			end(len(spectra))
+		}
+	}
+	sortNotes(notes)
+	return notes
+}
+
+// sort by onset, then by key
+func sortNotes(notes []NoteEvent) {
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Onset != notes[j].Onset {
+			return notes[i].Onset < notes[j].Onset
+		}
+		return noteIndex[notes[i].Key] < noteIndex[notes[j].Key]
+	})
+}
+
+func maxMagnitude(spectra []map[string]float64) float64 {
+	max := 0.0
+	for _, sp := range spectra {
+		for _, v := range sp {
+			max = math.Max(max, v)
+		}
+	}
+	return max
+}
@@ -0,0 +1,31 @@
+package dft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectNotes(t *testing.T) {
+	// A4 struck at frame 2, struck again at 6, C5 from 4 to 7, quiet noise
+	a4 := []float64{0, 0, 1, 0.8, 0.6, 0.4, 1, 0.9, 0.7, 0.05, 0, 0}
+	c5 := []float64{0, 0, 0, 0, 0.5, 0.5, 0.45, 0.05, 0, 0, 0, 0}
+	spectra := []map[string]float64{}
+	for i := range a4 {
+		spectra = append(spectra, map[string]float64{"A4": a4[i], "C5": c5[i], "F2": 0.05})
+	}
+	ms := time.Millisecond
+	want := []NoteEvent{
+		{"A4", 200 * ms, 600 * ms, 1},
+		{"C5", 400 * ms, 700 * ms, 0.5},
+		{"A4", 600 * ms, 900 * ms, 1},
+	}
+	got := DetectNotes(spectra, 100*ms, DefaultSegmentOptions)
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("note %d: want %v, got %v", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package dft
+
+// Parallel analysis. The file is read in order, cut into time ranges of a
+// few windows, and each range analysed on a pool of workers. Spectra are
+// put back in order before they are given to the caller.
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// windows in one time range given to a worker
+const parallelChunkFrames = 32
+
+type analysisJob struct {
+	first, last int         // index of first window, and one after the last
+	start       int         // sample index of samples[c][0]
+	samples     [][]float64 // [channel][sample]
+	spectra     [][]map[string]float64
+}
+
+// NumFrames return number of windows in the file, one every spacing
+func (k *Keys) NumFrames() int {
+	return int((k.fileLength + k.spacing - 1) / k.spacing)
+}
+
+// AnalyseParallel analyse windows from index from to the end of file, on
+// workers goroutines. emit is called with spectrum of every channel in
+// order of window, on the calling goroutine, an error from emit stop the
+// analysis. Return ctx.Err() when ctx is done before the end of file.
+func (k *Keys) AnalyseParallel(ctx context.Context, from, workers int, emit func(i int, sp []map[string]float64) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	numFrame := k.NumFrames()
+	if from >= numFrame {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	sr := k.buffer.Format().SampleRate
+
+	jobs := make(chan *analysisJob, workers)
+	results := make(chan *analysisJob, workers)
+	produced := make(chan struct{})
+	// every goroutine is finished on return, Keys can be used again
+	defer func() {
+		cancel()
+		for range results {
+		}
+		<-produced
+	}()
+
+	// read samples in order, Keys buffer is not shared with workers
+	go func() {
+		defer close(produced)
+		defer close(jobs)
+		for first := from; first < numFrame; first += parallelChunkFrames {
+			last := first + parallelChunkFrames
+			if last > numFrame {
+				last = numFrame
+			}
+			start := sr.N(time.Duration(first) * k.spacing)
+			end := sr.N(time.Duration(last-1)*k.spacing) + k.windowSize
+			if k.pre != nil {
+				// whole range is preprocessed at once
+				start -= k.pre.Context()
+				if start < 0 {
+					start = 0
+				}
+				end += k.pre.Context()
+			}
+			job := &analysisJob{first: first, last: last, start: start}
+			for _, sample := range k.channelSamples(start, end-start) {
+				job.samples = append(job.samples, append([]float64(nil), sample...))
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if k.pre != nil {
+					for c := range job.samples {
+						job.samples[c] = k.pre.Process(job.samples[c])
+					}
+				}
+				job.spectra = make([][]map[string]float64, 0, job.last-job.first)
+				for i := job.first; i < job.last; i++ {
+					sp := make([]map[string]float64, len(job.samples))
+					for c, samples := range job.samples {
+						s := sr.N(time.Duration(i)*k.spacing) - job.start
+						e := s + k.windowSize
+						// end of file, analyse what is left
+						if e > len(samples) {
+							e = len(samples)
+						}
+						if s > e {
+							s = e
+						}
+						sp[c] = k.analyse(samples[s:e])
+					}
+					job.spectra = append(job.spectra, sp)
+				}
+				select {
+				case results <- job:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// reorder, ranges may finish in any order
+	pending := map[int]*analysisJob{}
+	next := from
+	for job := range results {
+		pending[job.first] = job
+		for j, ok := pending[next]; ok; j, ok = pending[next] {
+			delete(pending, next)
+			for n, sp := range j.spectra {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := emit(j.first+n, sp); err != nil {
+					return err
+				}
+			}
+			next = j.last
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,79 @@
+package dft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAnalyseParallel(t *testing.T) {
+	sampleRate := 8000
+	data := []float64{}
+	for _, note := range []string{"A3", "C4", "E4", "G4", "A4", "C5", "E5"} {
+		data = append(data, generateSin(NoteFreq[note], sampleRate, sampleRate*3/2)...)
+	}
+	for _, name := range []string{"goertzel", "fft", "cqt"} {
+		seq := newTestKeys(data, sampleRate)
+		par := newTestKeys(data, sampleRate)
+		for _, k := range []*Keys{seq, par} {
+			a, _ := NewAnalyser(name, sampleRate, time.Millisecond*100)
+			k.SetAnalyser(a)
+			k.SetSpacing(time.Millisecond * 100)
+		}
+		want := []map[string]float64{}
+		for current := time.Duration(0); current < seq.Len(); current += seq.Spacing() {
+			want = append(want, seq.Analyse(current))
+		}
+		got := []map[string]float64{}
+		err := par.AnalyseParallel(context.Background(), 0, 4, func(i int, sp []map[string]float64) error {
+			if i != len(got) {
+				t.Fatalf("%s: got window %d, want %d", name, i, len(got))
+			}
+			got = append(got, sp[0])
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || len(got) != par.NumFrames() {
+			t.Fatalf("%s: got %d windows, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			for _, key := range noteName {
+				if got[i][key] != want[i][key] {
+					t.Fatalf("%s: window %d %s got %v, want %v", name, i, key, got[i][key], want[i][key])
+				}
+			}
+		}
+	}
+}
+
+func TestAnalyseParallelStop(t *testing.T) {
+	k := newTestKeys(generateSin(440, 8000, 8000*10), 8000)
+	k.SetSpacing(time.Millisecond * 100)
+	stop := errors.New("stop")
+	count := 0
+	err := k.AnalyseParallel(context.Background(), 10, 4, func(i int, sp []map[string]float64) error {
+		if count == 0 && i != 10 {
+			t.Errorf("first window %d, want 10", i)
+		}
+		count++
+		if count == 5 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 5 {
+		t.Errorf("got %v after %d windows", err, count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = k.AnalyseParallel(ctx, 0, 4, func(int, []map[string]float64) error {
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
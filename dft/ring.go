@@ -0,0 +1,52 @@
+package dft
+
+// ringBuffer keep the latest samples read from a stream, indexed by their
+// position in the stream. Oldest samples are overwritten when it is full.
+type ringBuffer struct {
+	data  []float64
+	start int // stream position of the oldest sample
+	end   int // stream position after the newest sample
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]float64, size)}
+}
+
+func (r *ringBuffer) push(v float64) {
+	r.data[r.end%len(r.data)] = v
+	r.end++
+	if r.end-r.start > len(r.data) {
+		r.start = r.end - len(r.data)
+	}
+}
+
+// reset drop every sample, next sample pushed is at stream position pos
+func (r *ringBuffer) reset(pos int) {
+	r.start = pos
+	r.end = pos
+}
+
+// reserve grow the buffer to hold at least size samples
+func (r *ringBuffer) reserve(size int) {
+	if size <= len(r.data) {
+		return
+	}
+	data := make([]float64, size)
+	for i := r.start; i < r.end; i++ {
+		data[i%size] = r.data[i%len(r.data)]
+	}
+	r.data = data
+}
+
+// copyTo copy samples from stream position from, return number copied
+func (r *ringBuffer) copyTo(dst []float64, from int) int {
+	if from < r.start {
+		return 0
+	}
+	n := 0
+	for i := from; i < r.end && n < len(dst); i++ {
+		dst[n] = r.data[i%len(r.data)]
+		n++
+	}
+	return n
+}
@@ -0,0 +1,484 @@
+package dft
+
+// Spectrum sidecar file, keep the spectra of an analysis next to the music
+// file, so the roll can be drawn again without analysing.
+//
+// Little endian, a fixed size header, then frames. Each frame is
+// channels * 88 float32, keys in order A0 to C8. The frame count in header
+// is updated after every frame, and the complete flag set at the end, so an
+// analysis stopped half way can be resumed.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var sidecarMagic = [4]byte{'M', 'R', 'S', 'P'}
+
+const sidecarVersion = 3
+
+// flags
+const (
+	sidecarComplete = 1 << 0 // all frames of the file are analysed
+	sidecarHarmonic = 1 << 1 // harmonic part only, after HPSS
+)
+
+type sidecarHeader struct {
+	Magic       [4]byte
+	Version     uint16
+	Flags       uint16
+	SampleRate  uint32
+	Channels    uint16 // spectra per frame
+	Keys        uint16
+	Spacing     int64 // nanosecond
+	WindowSize  uint32
+	Window      [16]byte // window function name
+	WindowBeta  float32
+	Reference   float32 // tuning, frequency of A4
+	Temperament [16]byte
+	Root        uint16
+	Offsets     [12]float32
+	ChannelIDs  [8]uint8 // index in ChannelNames
+	Analyser    [16]byte // name in AnalyserNames
+	Salience    [16]byte // name in PostProcessNames
+	Frames      uint32   // last, updated while writing
+}
+
+// header of version 2, no analyser and salience, they are unknown
+type sidecarHeaderV2 struct {
+	Magic       [4]byte
+	Version     uint16
+	Flags       uint16
+	SampleRate  uint32
+	Channels    uint16
+	Keys        uint16
+	Spacing     int64
+	WindowSize  uint32
+	Window      [16]byte
+	WindowBeta  float32
+	Reference   float32
+	Temperament [16]byte
+	Root        uint16
+	Offsets     [12]float32
+	ChannelIDs  [8]uint8
+	Frames      uint32
+}
+
+func (v2 sidecarHeaderV2) header() sidecarHeader {
+	return sidecarHeader{
+		Magic:       v2.Magic,
+		Version:     v2.Version,
+		Flags:       v2.Flags,
+		SampleRate:  v2.SampleRate,
+		Channels:    v2.Channels,
+		Keys:        v2.Keys,
+		Spacing:     v2.Spacing,
+		WindowSize:  v2.WindowSize,
+		Window:      v2.Window,
+		WindowBeta:  v2.WindowBeta,
+		Reference:   v2.Reference,
+		Temperament: v2.Temperament,
+		Root:        v2.Root,
+		Offsets:     v2.Offsets,
+		ChannelIDs:  v2.ChannelIDs,
+		Frames:      v2.Frames,
+	}
+}
+
+// header of version 1, one mix channel, and no harmonic flag
+type sidecarHeaderV1 struct {
+	Magic       [4]byte
+	Version     uint16
+	Flags       uint16
+	SampleRate  uint32
+	Channels    uint16
+	Keys        uint16
+	Spacing     int64
+	WindowSize  uint32
+	Window      [16]byte
+	WindowBeta  float32
+	Reference   float32
+	Temperament [16]byte
+	Root        uint16
+	Offsets     [12]float32
+	Frames      uint32
+}
+
+func (v1 sidecarHeaderV1) header() sidecarHeader {
+	h := sidecarHeaderV2{
+		Magic:       v1.Magic,
+		Version:     v1.Version,
+		Flags:       v1.Flags &^ sidecarHarmonic,
+		SampleRate:  v1.SampleRate,
+		Channels:    v1.Channels,
+		Keys:        v1.Keys,
+		Spacing:     v1.Spacing,
+		WindowSize:  v1.WindowSize,
+		Window:      v1.Window,
+		WindowBeta:  v1.WindowBeta,
+		Reference:   v1.Reference,
+		Temperament: v1.Temperament,
+		Root:        v1.Root,
+		Offsets:     v1.Offsets,
+		Frames:      v1.Frames,
+	}
+	h.ChannelIDs[0] = uint8(channelID("mix"))
+	return h.header()
+}
+
+// SpectrumFile is the content of a sidecar file
+type SpectrumFile struct {
+	SampleRate int
+	Spacing    time.Duration
+	WindowSize int
+	Analyser   string // from AnalyserNames, empty before version 3
+	Salience   string // from PostProcessNames, empty before version 3
+	Window     string // empty when the analyser has its own window
+	WindowBeta float64
+	Tuning     Tuning
+	Complete   bool                   // false when analysis stopped half way
+	Harmonic   bool                   // analysed after HPSS
+	Channels   []string               // from ChannelNames, mix if empty
+	Spectra    [][]map[string]float64 // [frame][channel]
+}
+
+func (sf *SpectrumFile) channels() []string {
+	if len(sf.Channels) == 0 {
+		return []string{"mix"}
+	}
+	return sf.Channels
+}
+
+// SameSettings is true when frames of other can be appended to sf
+func (sf *SpectrumFile) SameSettings(other *SpectrumFile) bool {
+	return sf.SampleRate == other.SampleRate &&
+		sf.Spacing == other.Spacing &&
+		sf.WindowSize == other.WindowSize &&
+		sf.Analyser == other.Analyser &&
+		sf.Salience == other.Salience &&
+		sf.Window == other.Window &&
+		sf.Harmonic == other.Harmonic &&
+		float32(sf.WindowBeta) == float32(other.WindowBeta) &&
+		sf.Tuning.Temperament == other.Tuning.Temperament &&
+		sf.Tuning.Root == other.Tuning.Root &&
+		float32(sf.Tuning.Reference) == float32(other.Tuning.Reference) &&
+		offsets32(sf.Tuning.Offsets) == offsets32(other.Tuning.Offsets) &&
+		strings.Join(sf.channels(), ",") == strings.Join(other.channels(), ",")
+}
+
+// offsets as stored in file
+func offsets32(o [12]float64) [12]float32 {
+	var f [12]float32
+	for i, c := range o {
+		f[i] = float32(c)
+	}
+	return f
+}
+
+func toFixed(s string) [16]byte {
+	var b [16]byte
+	copy(b[:], s)
+	return b
+}
+
+func fromFixed(b [16]byte) string {
+	return strings.TrimRight(string(b[:]), "\x00")
+}
+
+func (sf *SpectrumFile) header() sidecarHeader {
+	h := sidecarHeader{
+		Magic:       sidecarMagic,
+		Version:     sidecarVersion,
+		SampleRate:  uint32(sf.SampleRate),
+		Channels:    uint16(len(sf.channels())),
+		Keys:        uint16(len(noteName)),
+		Spacing:     int64(sf.Spacing),
+		WindowSize:  uint32(sf.WindowSize),
+		Window:      toFixed(sf.Window),
+		WindowBeta:  float32(sf.WindowBeta),
+		Analyser:    toFixed(sf.Analyser),
+		Salience:    toFixed(sf.Salience),
+		Reference:   float32(sf.Tuning.Reference),
+		Temperament: toFixed(sf.Tuning.Temperament),
+		Root:        uint16(sf.Tuning.Root),
+		Offsets:     offsets32(sf.Tuning.Offsets),
+		Frames:      uint32(len(sf.Spectra)),
+	}
+	for c, name := range sf.channels() {
+		h.ChannelIDs[c] = uint8(channelID(name))
+	}
+	if sf.Complete {
+		h.Flags |= sidecarComplete
+	}
+	if sf.Harmonic {
+		h.Flags |= sidecarHarmonic
+	}
+	return h
+}
+
+func channelID(name string) int {
+	for i, n := range ChannelNames {
+		if n == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// SaveSpectrum write spectrum file to path
+func SaveSpectrum(path string, sf *SpectrumFile) error {
+	if len(sf.channels()) > len(sidecarHeader{}.ChannelIDs) {
+		return fmt.Errorf("too many channels, %d", len(sf.channels()))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := binary.Write(w, binary.LittleEndian, sf.header()); err != nil {
+		f.Close()
+		return err
+	}
+	frame := make([]float32, len(sf.channels())*len(noteName))
+	for _, sp := range sf.Spectra {
+		if err := binary.Write(w, binary.LittleEndian, toFrame(sp, frame)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadSpectrum read spectrum file from path
+func LoadSpectrum(path string) (*SpectrumFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	h, err := readSidecarHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if int(h.Keys) != len(noteName) || h.Channels < 1 || int(h.Channels) > len(h.ChannelIDs) {
+		return nil, fmt.Errorf("unsupported spectrum file layout, %d channels of %d keys", h.Channels, h.Keys)
+	}
+	sf := &SpectrumFile{
+		SampleRate: int(h.SampleRate),
+		Spacing:    time.Duration(h.Spacing),
+		WindowSize: int(h.WindowSize),
+		Analyser:   fromFixed(h.Analyser),
+		Salience:   fromFixed(h.Salience),
+		Window:     fromFixed(h.Window),
+		WindowBeta: float64(h.WindowBeta),
+		Tuning: Tuning{
+			Reference:   float64(h.Reference),
+			Temperament: fromFixed(h.Temperament),
+			Root:        int(h.Root),
+		},
+		Complete: h.Flags&sidecarComplete != 0,
+		Harmonic: h.Flags&sidecarHarmonic != 0,
+	}
+	for i, c := range h.Offsets {
+		sf.Tuning.Offsets[i] = float64(c)
+	}
+	for _, id := range h.ChannelIDs[:h.Channels] {
+		if int(id) >= len(ChannelNames) {
+			return nil, fmt.Errorf("unknown channel %d in spectrum file", id)
+		}
+		sf.Channels = append(sf.Channels, ChannelNames[id])
+	}
+	frame := make([]float32, int(h.Channels)*len(noteName))
+	for n := 0; n < int(h.Frames); n++ {
+		if err := binary.Read(r, binary.LittleEndian, frame); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("spectrum file end at frame %d of %d", n, h.Frames)
+			}
+			return nil, err
+		}
+		sps := []map[string]float64{}
+		for c := 0; c < int(h.Channels); c++ {
+			sp := make(map[string]float64, len(noteName))
+			for i, key := range noteName {
+				sp[key] = float64(frame[c*len(noteName)+i])
+			}
+			sps = append(sps, sp)
+		}
+		sf.Spectra = append(sf.Spectra, sps)
+	}
+	return sf, nil
+}
+
+// readSidecarHeader read header of the current version, or of version 1
+func readSidecarHeader(r *bufio.Reader) (sidecarHeader, error) {
+	var h sidecarHeader
+	b, err := r.Peek(6)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return h, err
+	}
+	if !bytes.Equal(b[:4], sidecarMagic[:]) {
+		return h, errors.New("not a spectrum file")
+	}
+	switch v := binary.LittleEndian.Uint16(b[4:]); v {
+	case 1:
+		var v1 sidecarHeaderV1
+		if err := binary.Read(r, binary.LittleEndian, &v1); err != nil {
+			return h, err
+		}
+		if v1.Channels != 1 {
+			return h, fmt.Errorf("unsupported spectrum file layout, %d channels in version 1", v1.Channels)
+		}
+		return v1.header(), nil
+	case 2:
+		var v2 sidecarHeaderV2
+		if err := binary.Read(r, binary.LittleEndian, &v2); err != nil {
+			return h, err
+		}
+		return v2.header(), nil
+	case sidecarVersion:
+		err := binary.Read(r, binary.LittleEndian, &h)
+		return h, err
+	default:
+		return h, fmt.Errorf("unsupported spectrum file version %d", v)
+	}
+}
+
+// every channel of a frame, in one slice of len(sp) * 88
+func toFrame(sp []map[string]float64, frame []float32) []float32 {
+	for c := range sp {
+		for i, key := range noteName {
+			frame[c*len(noteName)+i] = float32(sp[c][key])
+		}
+	}
+	return frame[:len(sp)*len(noteName)]
+}
+
+// SpectrumWriter write frames one by one to a spectrum file, the file can
+// be loaded any time and has every frame written so far
+type SpectrumWriter struct {
+	f      *os.File
+	header sidecarHeader
+	frame  []float32
+}
+
+var (
+	sidecarHeaderSize = binary.Size(sidecarHeader{})
+	// position of fields updated while writing
+	sidecarFlagsAt  = int64(6)
+	sidecarFramesAt = int64(sidecarHeaderSize - 4)
+)
+
+// CreateSpectrum start a new spectrum file with settings of sf, and frames
+// already in sf
+func CreateSpectrum(path string, sf *SpectrumFile) (*SpectrumWriter, error) {
+	if err := SaveSpectrum(path, sf); err != nil {
+		return nil, err
+	}
+	return OpenSpectrum(path)
+}
+
+// OpenSpectrum continue writing a spectrum file after its last frame
+func OpenSpectrum(path string) (*SpectrumWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	w := &SpectrumWriter{f: f}
+	if err := binary.Read(f, binary.LittleEndian, &w.header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if w.header.Magic != sidecarMagic || w.header.Version != sidecarVersion {
+		f.Close()
+		return nil, errors.New("not a spectrum file")
+	}
+	w.frame = make([]float32, int(w.header.Channels)*len(noteName))
+	return w, nil
+}
+
+// Append write one frame, spectrum of every channel, then the frame count
+func (w *SpectrumWriter) Append(sp []map[string]float64) error {
+	if len(sp) != int(w.header.Channels) {
+		return fmt.Errorf("got %d channels, file has %d", len(sp), w.header.Channels)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, toFrame(sp, w.frame))
+	at := int64(sidecarHeaderSize) + int64(w.header.Frames)*int64(buf.Len())
+	if _, err := w.f.WriteAt(buf.Bytes(), at); err != nil {
+		return err
+	}
+	w.header.Frames++
+	return w.writeField(sidecarFramesAt, w.header.Frames)
+}
+
+// Frames return number of frames in file
+func (w *SpectrumWriter) Frames() int {
+	return int(w.header.Frames)
+}
+
+// Complete mark the file as fully analysed
+func (w *SpectrumWriter) Complete() error {
+	w.header.Flags |= sidecarComplete
+	return w.writeField(sidecarFlagsAt, w.header.Flags)
+}
+
+func (w *SpectrumWriter) writeField(at int64, v interface{}) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	_, err := w.f.WriteAt(buf.Bytes(), at)
+	return err
+}
+
+func (w *SpectrumWriter) Close() error {
+	return w.f.Close()
+}
+
+// SpectrumFile return settings of the analysis, with spectra so far
+func (k *Keys) SpectrumFile() *SpectrumFile {
+	k.dataMu.Lock()
+	spectra := k.spectrum
+	k.dataMu.Unlock()
+	sf := &SpectrumFile{
+		SampleRate: k.SampleRate(),
+		Spacing:    k.spacing,
+		WindowSize: k.windowSize,
+		Analyser:   AnalyserName(k.analyser),
+		Salience:   k.salience,
+		Window:     rectangular,
+		Tuning:     k.tuning,
+		Channels:   k.channels,
+		Spectra:    spectra,
+	}
+	_, sf.Harmonic = k.pre.(*HPSS)
+	// analysers without Windowed use their own window, none is recorded
+	if _, ok := k.analyser.(Windowed); !ok {
+		sf.Window = ""
+	} else if k.window != nil {
+		sf.Window = k.window.Name()
+		sf.WindowBeta = k.window.Beta()
+	}
+	return sf
+}
+
+// SaveSpectrum write spectra from AnalyseAll to path, with the settings
+// they are analysed with
+func (k *Keys) SaveSpectrum(path string) error {
+	sf := k.SpectrumFile()
+	sf.Complete = true
+	return SaveSpectrum(path, sf)
+}
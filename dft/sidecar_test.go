@@ -0,0 +1,194 @@
+package dft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpectrumFile(t *testing.T) {
+	tuning, _ := NewTuning(442, "meantone", 2)
+	sf := &SpectrumFile{
+		SampleRate: 44100,
+		Spacing:    time.Millisecond * 100,
+		WindowSize: 4410,
+		Analyser:   "fft",
+		Salience:   "whiten",
+		Window:     kaiser,
+		WindowBeta: 8.5,
+		Tuning:     tuning,
+	}
+	for i := 0; i < 5; i++ {
+		sp := make(map[string]float64)
+		sp[noteName[i*10]] = float64(i) + 0.25
+		sf.Spectra = append(sf.Spectra, []map[string]float64{sp})
+	}
+	path := filepath.Join(t.TempDir(), "a.spectrum")
+	if err := SaveSpectrum(path, sf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SampleRate != sf.SampleRate || got.Spacing != sf.Spacing ||
+		got.WindowSize != sf.WindowSize || got.Window != sf.Window || got.WindowBeta != sf.WindowBeta {
+		t.Errorf("header got %+v, want %+v", got, sf)
+	}
+	if got.Analyser != "fft" || got.Salience != "whiten" || !got.SameSettings(sf) {
+		t.Errorf("got analyser %q, salience %q", got.Analyser, got.Salience)
+	}
+	other := *sf
+	other.Analyser = "cqt"
+	if got.SameSettings(&other) {
+		t.Errorf("same settings with another analyser")
+	}
+	other = *sf
+	other.Salience = "none"
+	if got.SameSettings(&other) {
+		t.Errorf("same settings with another salience")
+	}
+	if got.Tuning.Temperament != "meantone" || got.Tuning.Root != 2 || got.Tuning.Reference != 442 {
+		t.Errorf("tuning got %v", got.Tuning)
+	}
+	if len(got.Spectra) != len(sf.Spectra) {
+		t.Fatalf("got %d frames, want %d", len(got.Spectra), len(sf.Spectra))
+	}
+	for i, sp := range sf.Spectra {
+		for _, key := range noteName {
+			if got.Spectra[i][0][key] != sp[0][key] {
+				t.Errorf("frame %d %s got %v, want %v", i, key, got.Spectra[i][0][key], sp[0][key])
+			}
+		}
+	}
+}
+
+func TestSpectrumWriter(t *testing.T) {
+	sf := &SpectrumFile{SampleRate: 8000, Spacing: time.Millisecond * 100, Window: hann, Tuning: EqualTuning}
+	path := filepath.Join(t.TempDir(), "a.spectrum")
+	w, err := CreateSpectrum(path, sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Append([]map[string]float64{{"A4": 1}})
+	w.Close()
+
+	// stopped half way, continue where it was
+	got, err := LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Complete || len(got.Spectra) != 1 || !got.SameSettings(sf) {
+		t.Fatalf("got complete %v, %d frames, same settings %v", got.Complete, len(got.Spectra), got.SameSettings(sf))
+	}
+	w, err = OpenSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Frames() != 1 {
+		t.Errorf("got %d frames, want 1", w.Frames())
+	}
+	w.Append([]map[string]float64{{"C4": 0.5}})
+	if err := w.Complete(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	got, err = LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Complete || len(got.Spectra) != 2 {
+		t.Fatalf("got complete %v, %d frames", got.Complete, len(got.Spectra))
+	}
+	if got.Spectra[0][0]["A4"] != 1 || got.Spectra[1][0]["C4"] != 0.5 {
+		t.Errorf("got frames %v %v", got.Spectra[0][0]["A4"], got.Spectra[1][0]["C4"])
+	}
+}
+
+func TestSpectrumFileV1(t *testing.T) {
+	h := sidecarHeaderV1{
+		Magic:      sidecarMagic,
+		Version:    1,
+		Flags:      sidecarComplete,
+		SampleRate: 44100,
+		Channels:   1,
+		Keys:       uint16(len(noteName)),
+		Spacing:    int64(time.Millisecond * 100),
+		Window:     toFixed(hann),
+		Reference:  440,
+		Frames:     2,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	frame := make([]float32, len(noteName))
+	for i := 0; i < 2; i++ {
+		frame[48] = float32(i) + 0.5
+		binary.Write(&buf, binary.LittleEndian, frame)
+	}
+	path := filepath.Join(t.TempDir(), "a.spectrum")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Complete || got.Harmonic || len(got.Channels) != 1 || got.Channels[0] != "mix" {
+		t.Errorf("got complete %v, harmonic %v, channels %v", got.Complete, got.Harmonic, got.Channels)
+	}
+	if len(got.Spectra) != 2 || got.Spectra[1][0][noteName[48]] != 1.5 {
+		t.Errorf("got %d frames", len(got.Spectra))
+	}
+}
+
+func TestSpectrumFileWindow(t *testing.T) {
+	k := newTestKeys(make([]float64, 8000), 8000)
+	w, _ := NewWindow(hann, 0)
+	k.SetWindow(w)
+	k.SetAnalyser(NewFFTAnalyser(8000, time.Millisecond*100))
+	if got := k.SpectrumFile().Window; got != hann {
+		t.Errorf("fft window got %q, want %q", got, hann)
+	}
+	// the window has no effect on dft, it is not recorded
+	k.SetAnalyser(NewDFTAnalyser(8000, time.Millisecond*100))
+	if got := k.SpectrumFile().Window; got != "" {
+		t.Errorf("dft window got %q, want none", got)
+	}
+	if sf := k.SpectrumFile(); sf.Analyser != "dft" || sf.Salience != "none" {
+		t.Errorf("got analyser %q, salience %q", sf.Analyser, sf.Salience)
+	}
+	if !IsWindowed("goertzel") || IsWindowed("cqt") {
+		t.Errorf("goertzel should take a window, cqt not")
+	}
+}
+
+func TestSpectrumFileV2(t *testing.T) {
+	h := sidecarHeaderV2{
+		Magic:      sidecarMagic,
+		Version:    2,
+		Flags:      sidecarComplete | sidecarHarmonic,
+		SampleRate: 44100,
+		Channels:   1,
+		Keys:       uint16(len(noteName)),
+		Spacing:    int64(time.Millisecond * 100),
+		Reference:  440,
+	}
+	h.ChannelIDs[0] = uint8(channelID("left"))
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	path := filepath.Join(t.TempDir(), "a.spectrum")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSpectrum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Complete || !got.Harmonic || got.Channels[0] != "left" || got.Analyser != "" || got.Salience != "" {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,33 @@
+package dft
+
+// Transpose spectra, so a roll is drawn in another key. Keys move along
+// noteName, a semitone at a time, the drawn position then come from
+// keyPosMid as any other key.
+
+// TransposeSpectrum move every key by semitones, following the keys of
+// noteName, keys moved past either end of the keyboard are dropped
+func TransposeSpectrum(spectrum map[string]float64, semitones int) map[string]float64 {
+	out := make(map[string]float64, len(spectrum))
+	for key, v := range spectrum {
+		i, ok := noteIndex[key]
+		if !ok {
+			continue
+		}
+		if j := i + semitones; j >= 0 && j < len(noteName) {
+			out[noteName[j]] = v
+		}
+	}
+	return out
+}
+
+// TransposeSpectra transpose spectra of [window][channel]
+func TransposeSpectra(spectra [][]map[string]float64, semitones int) [][]map[string]float64 {
+	out := make([][]map[string]float64, len(spectra))
+	for i, sp := range spectra {
+		out[i] = make([]map[string]float64, len(sp))
+		for c := range sp {
+			out[i][c] = TransposeSpectrum(sp[c], semitones)
+		}
+	}
+	return out
+}
@@ -0,0 +1,18 @@
+package dft
+
+import "testing"
+
+func TestTransposeSpectra(t *testing.T) {
+	spectra := [][]map[string]float64{{{"C4": 1, "A0": 0.5, "C8": 0.25}}}
+	got := TransposeSpectra(spectra, 2)[0][0]
+	if len(got) != 2 || got["D4"] != 1 || got["B0"] != 0.5 {
+		t.Errorf("up 2 got %v", got)
+	}
+	got = TransposeSpectra(spectra, -12)[0][0]
+	if len(got) != 2 || got["C3"] != 1 || got["C7"] != 0.25 {
+		t.Errorf("down 12 got %v", got)
+	}
+	if spectra[0][0]["C4"] != 1 {
+		t.Errorf("spectra changed")
+	}
+}
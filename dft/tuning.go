@@ -0,0 +1,119 @@
+package dft
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Tuning give frequency of every key, from frequency of A4 and a temperament
+type Tuning struct {
+	Reference   float64 // frequency of A4, Hz
+	Temperament string
+	Root        int // pitch class the temperament is built on, C is 0
+	// cents away from equal temperament, index by semitone above Root
+	Offsets [12]float64
+}
+
+// pitch class names, C is 0, same spelling as noteName
+var PitchClassNames = []string{"C", "Cs", "D", "Ds", "E", "F", "Fs", "G", "Gs", "A", "As", "B"}
+
+// temperament tables, cents away from equal temperament, built on C
+var temperaments = map[string][12]float64{
+	"equal": {},
+	// pure fifths from Db to Fs, wolf between Fs and Cs
+	"pythagorean": {0, -9.78, 3.91, -5.87, 7.82, -1.96, 11.73, 1.96, -7.82, 5.87, -3.91, 9.78},
+	// 5-limit just intonation
+	"just": {0, 11.73, 3.91, 15.64, -13.69, -1.96, -9.78, 1.96, 13.69, -15.64, 17.60, -11.73},
+	// quarter-comma meantone, pure major thirds
+	"meantone": {0, -23.95, -6.84, 10.26, -13.69, 3.42, -20.53, -3.42, -27.37, -10.26, 6.84, -17.11},
+	// Werckmeister III
+	"werckmeister": {0, -9.78, -7.82, -5.87, -9.78, -1.96, -11.73, -3.91, -7.82, -11.73, -3.91, -7.82},
+}
+
+// names accepted by NewTuning, custom offsets use CustomTuning
+var TemperamentNames = []string{"equal", "pythagorean", "just", "meantone", "werckmeister"}
+
+// A4 = 440 Hz, equal temperament, same as NoteFreq
+var EqualTuning = Tuning{Reference: 440, Temperament: "equal"}
+
+// NewTuning create tuning with a temperament from TemperamentNames, built on
+// pitch class root
+func NewTuning(reference float64, temperament string, root int) (Tuning, error) {
+	offsets, ok := temperaments[temperament]
+	if !ok {
+		return Tuning{}, fmt.Errorf("unknown temperament %q", temperament)
+	}
+	return Tuning{
+		Reference:   reference,
+		Temperament: temperament,
+		Root:        ((root % 12) + 12) % 12,
+		Offsets:     offsets,
+	}, nil
+}
+
+// CustomTuning create tuning with cents offsets for each semitone above root
+func CustomTuning(reference float64, root int, offsets [12]float64) Tuning {
+	return Tuning{
+		Reference:   reference,
+		Temperament: "custom",
+		Root:        ((root % 12) + 12) % 12,
+		Offsets:     offsets,
+	}
+}
+
+// PitchClass return pitch class of a name in PitchClassNames, sharp may be
+// written as "s" or "#"
+func PitchClass(name string) (int, error) {
+	name = strings.Replace(name, "#", "s", 1)
+	for i, n := range PitchClassNames {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pitch class %q", name)
+}
+
+// cents away from equal temperament for key index i in noteName, offsets
+// are shifted so A stay at the reference pitch
+func (t Tuning) cents(i int) float64 {
+	pc := (i + 9) % 12 // noteName start at A
+	a := t.Offsets[(9-t.Root+12)%12]
+	return t.Offsets[(pc-t.Root+12)%12] - a
+}
+
+// Freq return frequency of key, e.g. "A4", 0 for unknown key
+func (t Tuning) Freq(key string) float64 {
+	for i, n := range noteName {
+		if n == key {
+			return t.freq(i)
+		}
+	}
+	return 0
+}
+
+func (t Tuning) freq(i int) float64 {
+	return t.Reference * math.Pow(2, (float64(i-48)+t.cents(i)/100)/12)
+}
+
+// Frequencies return frequency of every key
+func (t Tuning) Frequencies() map[string]float64 {
+	f := make(map[string]float64, len(noteName))
+	for i, n := range noteName {
+		f[n] = t.freq(i)
+	}
+	return f
+}
+
+// Shift return tuning with reference pitch moved by cents
+func (t Tuning) Shift(cents float64) Tuning {
+	t.Reference *= math.Pow(2, cents/1200)
+	return t
+}
+
+func (t Tuning) String() string {
+	if t.Temperament == "equal" {
+		return fmt.Sprintf("A4=%.1fHz", t.Reference)
+	}
+	return fmt.Sprintf("A4=%.1fHz %s on %s", t.Reference, t.Temperament, PitchClassNames[t.Root])
+}
@@ -0,0 +1,61 @@
+package dft
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTuningFreq(t *testing.T) {
+	for _, key := range noteName {
+		if math.Abs(EqualTuning.Freq(key)-NoteFreq[key]) > 1e-9 {
+			t.Errorf("%s: equal tuning %f, NoteFreq %f", key, EqualTuning.Freq(key), NoteFreq[key])
+		}
+	}
+	baroque, _ := NewTuning(415, "equal", 0)
+	if f := baroque.Freq("A4"); f != 415 {
+		t.Errorf("A4 want 415, got %f", f)
+	}
+	// just intonation on A, fifth is 3/2 and major third 5/4 of A
+	just, _ := NewTuning(440, "just", 9)
+	if f := just.Freq("E5"); math.Abs(f-660) > 0.01 {
+		t.Errorf("E5 want 660, got %f", f)
+	}
+	if f := just.Freq("Cs5"); math.Abs(f-550) > 0.01 {
+		t.Errorf("Cs5 want 550, got %f", f)
+	}
+	if _, err := NewTuning(440, "slendro", 0); err == nil {
+		t.Error("want error for unknown temperament")
+	}
+}
+
+func TestTunedAnalysis(t *testing.T) {
+	// A4 at 415Hz is Gs4 at 440Hz
+	baroque, _ := NewTuning(415, "equal", 0)
+	for _, name := range AnalyserNames {
+		a, _ := NewAnalyser(name, 44100, time.Millisecond*100)
+		a.(Tuned).SetTuning(baroque)
+		sp := a.Analyse(generateSin(415, 44100, a.WindowSize()))
+		if sp["A4"] < sp["Gs4"] || sp["A4"] < sp["As4"] {
+			t.Errorf("%s: A4 %f weaker than neighbour Gs4 %f, As4 %f", name, sp["A4"], sp["Gs4"], sp["As4"])
+		}
+	}
+}
+
+func TestEstimateTuning(t *testing.T) {
+	for _, cents := range []float64{0, 19.6, -31, 45} {
+		tuning := EqualTuning.Shift(cents)
+		data := make([]float64, 44100*5)
+		for _, note := range []string{"A3", "E4", "Cs5", "Fs5", "B5"} {
+			data = combineNotes(data, generateSin(tuning.Freq(note), 44100, len(data)))
+		}
+		got, err := EstimateTuning(context.Background(), newTestKeys(data, 44100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-cents) > 3 {
+			t.Errorf("want %.1f cents, got %.1f", cents, got)
+		}
+	}
+}
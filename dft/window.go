@@ -0,0 +1,130 @@
+package dft
+
+// Window functions, applied to samples before analysis to reduce spectral
+// leakage between neighbour keys
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	rectangular    = "rectangular"
+	hann           = "hann"
+	hamming        = "hamming"
+	blackmanHarris = "blackman-harris"
+	kaiser         = "kaiser"
+)
+
+// names accepted by NewWindow
+var WindowNames = []string{rectangular, hann, hamming, blackmanHarris, kaiser}
+
+// shared by PianoDFT
+var rectangularWindow = Rectangular()
+
+type Window struct {
+	name string
+	beta float64 // kaiser only
+	lobe float64 // half width of main lobe, in DFT bins
+	fn   func(i, n int) float64
+
+	mu    sync.Mutex
+	cache map[int][]float64 // window length -> coefficients
+}
+
+func newWindow(name string, lobe float64, fn func(i, n int) float64) *Window {
+	return &Window{name: name, lobe: lobe, fn: fn, cache: map[int][]float64{}}
+}
+
+// NewWindow create a window by name, beta is only used by kaiser
+func NewWindow(name string, beta float64) (*Window, error) {
+	switch name {
+	case rectangular:
+		return Rectangular(), nil
+	case hann:
+		return Hann(), nil
+	case hamming:
+		return Hamming(), nil
+	case blackmanHarris:
+		return BlackmanHarris(), nil
+	case kaiser:
+		return Kaiser(beta), nil
+	}
+	return nil, fmt.Errorf("unknown window %q", name)
+}
+
+// Rectangular window, samples used as is
+func Rectangular() *Window {
+	return newWindow(rectangular, 1, func(i, n int) float64 {
+		return 1
+	})
+}
+
+func Hann() *Window {
+	return newWindow(hann, 2, func(i, n int) float64 {
+		return 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	})
+}
+
+func Hamming() *Window {
+	return newWindow(hamming, 2, func(i, n int) float64 {
+		return 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	})
+}
+
+// BlackmanHarris is the 4 term Blackman-Harris window, -92dB side lobes
+func BlackmanHarris() *Window {
+	return newWindow(blackmanHarris, 4, func(i, n int) float64 {
+		x := 2 * math.Pi * float64(i) / float64(n-1)
+		return 0.35875 - 0.48829*math.Cos(x) + 0.14128*math.Cos(2*x) - 0.01168*math.Cos(3*x)
+	})
+}
+
+// Kaiser window, larger beta give lower side lobes and wider main lobe
+func Kaiser(beta float64) *Window {
+	w := newWindow(kaiser, math.Sqrt(1+(beta/math.Pi)*(beta/math.Pi)), func(i, n int) float64 {
+		r := 2*float64(i)/float64(n-1) - 1
+		return besselI0(beta*math.Sqrt(1-r*r)) / besselI0(beta)
+	})
+	w.beta = beta
+	return w
+}
+
+func (w *Window) Name() string {
+	return w.name
+}
+
+func (w *Window) Beta() float64 {
+	return w.beta
+}
+
+// Coefficients return the window of length n, cached
+func (w *Window) Coefficients(n int) []float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if c, ok := w.cache[n]; ok {
+		return c
+	}
+	c := make([]float64, n)
+	if n == 1 {
+		c[0] = 1
+	} else {
+		for i := range c {
+			c[i] = w.fn(i, n)
+		}
+	}
+	w.cache[n] = c
+	return c
+}
+
+// modified Bessel function of the first kind, order 0
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		t := x / (2 * float64(k))
+		term *= t * t
+		sum += term
+	}
+	return sum
+}
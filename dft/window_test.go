@@ -0,0 +1,38 @@
+package dft
+
+import "testing"
+
+// leakage of A4 into its neighbour As4, relative to A4
+func leakage(w *Window) float64 {
+	sample := generateNote("A4", 44100, 16, 1)
+	sp := PianoDFTWindow(sample, 44100, w)
+	return sp["As4"] / sp["A4"]
+}
+
+func TestWindowLeakage(t *testing.T) {
+	rect := leakage(Rectangular())
+	if rect < 0.1 {
+		t.Errorf("rectangular leakage %f, expected heavy leakage", rect)
+	}
+	for _, name := range WindowNames[1:] {
+		w, err := NewWindow(name, 8.6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := leakage(w)
+		t.Logf("%s: %f (rectangular %f)", name, l, rect)
+		if l > 0.02 {
+			t.Errorf("%s leakage A4 into As4 %f, want < 0.02", name, l)
+		}
+	}
+}
+
+func TestWindowKeepMagnitude(t *testing.T) {
+	sample := generateSin(NoteFreq["A4"], 44100, 44100)
+	for _, name := range WindowNames {
+		w, _ := NewWindow(name, 8.6)
+		if v := PianoDFTWindow(sample, 44100, w)["A4"]; v < 0.49 || v > 0.51 {
+			t.Errorf("%s: sine magnitude %f, want 0.5", name, v)
+		}
+	}
+}
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/faiface/beep v1.1.0
 	github.com/hajimehoshi/ebiten/v2 v2.4.16
+	gonum.org/v1/gonum v0.12.0
 	gonum.org/v1/plot v0.12.0
 )
 
@@ -24,13 +25,13 @@ require (
 	github.com/go-pdf/fpdf v0.6.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/hajimehoshi/file2byteslice v1.0.0 // indirect
-	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/hajimehoshi/go-mp3 v0.3.4 // indirect
 	github.com/iatearock/dango v0.0.0-20230215211050-8fc5f65ff437
 	github.com/icza/bitio v1.0.0 // indirect
 	github.com/jezek/xgb v1.1.0 // indirect
 	github.com/jfreymuth/oggvorbis v1.0.4 // indirect
 	github.com/jfreymuth/vorbis v1.0.2 // indirect
-	github.com/mewkiz/flac v1.0.7 // indirect
+	github.com/mewkiz/flac v1.0.7
 	github.com/mewkiz/pkg v0.0.0-20190919212034-518ade7978e2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sqweek/dialog v0.0.0-20220809060634-e981b270ebbf
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
 	"github.com/iatearock/dango"
 	"github.com/iatearock/dango/ui"
 	"github.com/sqweek/dialog"
 	"golang.org/x/image/font"
+	"iatearock.com/musicroll/dft"
 )
 
 //go:embed assets/*
@@ -33,9 +39,21 @@ var (
 	buttonForward *ui.Button
 	buttonRewind  *ui.Button
 	buttonAnalyse *ui.Button
+	buttonMidi    *ui.Button
+	buttonCancel  *ui.Button
+	buttonSpeed   *ui.Button
 	analysing     bool
 
+	cancelAnalysis  context.CancelFunc // stop the running analysis
+	analysisStopped chan struct{}      // closed when the analysis has stopped
+	analysisResults chan analysisResult
+
 	infoMsg              string
+	tuningInfo           string // detected tuning offset
+	chords               []dft.ChordEvent
+	chordsMu             sync.Mutex // chords are set by the analysis too
+	keyInfo              string     // detected key, e.g. D minor
+	tempoInfo            string     // detected tempo
 	musicPath            string
 	pianoRollPath        string
 	pianoRollExist       bool
@@ -46,16 +64,57 @@ var (
 	pianoRollImgProgress string
 	pianoRollImgY        float64
 
+	refRollImg    *ebiten.Image // reference roll from a MIDI file
+	refSpectra    []map[string]float64
+	refRollImgOp  *ebiten.DrawImageOptions
+	refRollMode   int
+	refRollHeight int
+
 	keyboardImg   *ebiten.Image
 	keyboardImgOp *ebiten.DrawImageOptions
 	keyboardImgY  float64 = float64(screenHeight - 98 - 30)
 
+	scaleImg  *ebiten.Image // keys in scale of the detected key
+	showScale bool          // K key to switch
+
+	beatImg   *ebiten.Image // beat and bar lines, same size as pianoRollImg
+	showBeats = true        // B key to switch
+
+	rollSpectra [][]map[string]float64 // spectra of the roll, to draw it transposed
+	rollSpacing time.Duration
+	transpose   int // semitones, [ and ] keys
+
+	dragging bool          // dragging a loop on the roll
+	dragFrom time.Duration // where the drag started
+
 	ac *AudioControl
 )
 
 type Game struct {
 }
 
+// speeds of the Speed button, - and = keys change speed by speedStep
+// returned by Update when the window is closed
+var errQuit = errors.New("quit")
+
+var playbackSpeeds = []float64{1, 0.75, 0.5}
+
+const (
+	speedStep = 0.05
+	minSpeed  = 0.25
+	maxSpeed  = 1.5
+
+	maxTranspose = 12 // semitones up or down
+)
+
+// how reference roll is drawn with the analysed roll, M key to switch
+const (
+	refOverlay = iota
+	refAlongside
+	refHidden
+	numRefMode
+)
+
 func (g *Game) Draw(screen *ebiten.Image) {
 
 	text.Draw(screen, musicPath, font18, 10, 30, color.White)
@@ -74,6 +133,12 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				ac.Current().Seconds(),
 				ac.length-ac.Current().Seconds()),
 			font18, screenWidth-180, 100, color.White)
+		chordsMu.Lock()
+		if chords != nil {
+			text.Draw(screen, "Chord: "+dft.ChordAt(chords, ac.Current()),
+				font18, screenWidth-180, 75, color.White)
+		}
+		chordsMu.Unlock()
 		if ac.IsPlaying() {
 			buttonPause.Draw(screen)
 		} else if ac.IsEnded() {
@@ -83,25 +148,124 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		}
 		buttonBack.Draw(screen)
 		buttonForward.Draw(screen)
+		buttonMidi.Draw(screen)
+		buttonSpeed.Draw(screen)
+		text.Draw(screen, fmt.Sprintf("%.0f%%", ac.Speed()*100), font18, 275, 62, color.White)
+		if transpose != 0 {
+			text.Draw(screen, fmt.Sprintf("Transpose %+d", transpose), font18, 330, 62, color.White)
+		}
 	}
 
 	// Has piano roll image
+	if refRollImg != nil && ac != nil && refRollMode != refHidden {
+		refRollImgOp.GeoM.Reset()
+		refRollImgOp.ColorM.Reset()
+		if refRollMode == refAlongside {
+			refRollImgOp.GeoM.Scale(0.5, 1)
+			refRollImgOp.GeoM.Translate(float64(screenWidth)/2, 0)
+		} else if pianoRollImg != nil {
+			refRollImgOp.ColorM.Scale(1, 1, 1, 0.5)
+		}
+		refRollImgOp.GeoM.Translate(0, rollY(refRollHeight))
+		screen.DrawImage(refRollImg, refRollImgOp)
+	}
 	if pianoRollImg != nil && ac != nil {
 		pianoRollImgOp.GeoM.Reset()
-		ratio := ac.Current().Seconds() / ac.length
-		deltaImgY := float64(pianoRollImgHeight) * (1.0 - ratio)
-		pianoRollImgY = keyboardImgY - deltaImgY
+		if refRollImg != nil && refRollMode == refAlongside {
+			pianoRollImgOp.GeoM.Scale(0.5, 1)
+		}
+		pianoRollImgY = rollY(pianoRollImgHeight)
 		pianoRollImgOp.GeoM.Translate(0, pianoRollImgY)
 		screen.DrawImage(pianoRollImg, pianoRollImgOp)
+		if beatImg != nil && showBeats {
+			screen.DrawImage(beatImg, pianoRollImgOp)
+		}
 	} else if ac != nil && !analysing && pianoRollImg == nil {
 		// No image, Has file, and image file not found
 		buttonAnalyse.Draw(screen)
 	}
+	if analysing {
+		buttonCancel.Draw(screen)
+	}
+	if ac != nil {
+		drawLoop(screen)
+	}
 
 	screen.DrawImage(keyboardImg, keyboardImgOp)
+	if showScale && scaleImg != nil {
+		screen.DrawImage(scaleImg, keyboardImgOp)
+	}
 
 	// ebitenutil.DebugPrintAt(screen, infoMsg, 10, 460)
 	text.Draw(screen, infoMsg, font18, 10, screenHeight-10, color.White)
+	text.Draw(screen, tuningInfo, font18, screenWidth-260, screenHeight-10, color.White)
+	text.Draw(screen, keyInfo, font18, screenWidth-180, 125, color.White)
+	text.Draw(screen, tempoInfo, font18, screenWidth-180, 150, color.White)
+}
+
+// y position of a roll image of height, scrolled to current time
+func rollY(height int) float64 {
+	ratio := ac.Current().Seconds() / ac.length
+	deltaImgY := float64(height) * (1.0 - ratio)
+	return keyboardImgY - deltaImgY
+}
+
+// y on screen of time t of the roll, as it is drawn by rollY, the roll
+// cover the whole length of the sound
+func timeToY(t time.Duration) float64 {
+	h := rollHeight()
+	return rollY(h) + float64(h)*(1-t.Seconds()/ac.length)
+}
+
+// time of the roll at y on screen, inverse of timeToY
+func yToTime(y float64) time.Duration {
+	h := rollHeight()
+	if h == 0 {
+		return 0
+	}
+	sec := ac.length * (1 - (y-rollY(h))/float64(h))
+	sec = math.Max(0, math.Min(ac.length, sec))
+	return time.Duration(sec * 1e9)
+}
+
+// height of the roll on screen, also without an image
+func rollHeight() int {
+	if pianoRollImg != nil {
+		return pianoRollImgHeight
+	}
+	if refRollImg != nil {
+		return refRollHeight
+	}
+	// no roll, the whole sound fit above the keyboard
+	return int(keyboardImgY)
+}
+
+// shade loop region on the roll, or the line of A when B is not set yet
+func drawLoop(screen *ebiten.Image) {
+	a, b, ok := ac.Loop()
+	if dragging {
+		_, y := ebiten.CursorPosition()
+		a, b, ok = dragFrom, yToTime(float64(y)), true
+		if b < a {
+			a, b = b, a
+		}
+	}
+	if ok {
+		top := math.Max(0, timeToY(b))
+		bottom := math.Min(keyboardImgY, timeToY(a))
+		if bottom > top {
+			ebitenutil.DrawRect(screen, 0, top, float64(screenWidth), bottom-top, color.RGBA{255, 220, 0, 50})
+		}
+	} else if a, ok := ac.LoopA(); ok {
+		if y := timeToY(a); y < keyboardImgY {
+			ebitenutil.DrawRect(screen, 0, y-1, float64(screenWidth), 2, color.RGBA{255, 220, 0, 160})
+		}
+	}
+}
+
+// is y on the roll, below the buttons and above the keyboard
+func onRoll(y int) bool {
+	return y > 80 && float64(y) < keyboardImgY
 }
 
 func (g *Game) Layout(outsideWidth, ousideHeight int) (int, int) {
@@ -109,6 +273,14 @@ func (g *Game) Layout(outsideWidth, ousideHeight int) (int, int) {
 }
 
 func (g *Game) Update() error {
+	if ebiten.IsWindowBeingClosed() {
+		// stop analysis, and wait so no file is left half written
+		if analysisStopped != nil {
+			cancelAnalysis()
+			<-analysisStopped
+		}
+		return errQuit
+	}
 	if musicPath == "" {
 		// ======== NO FILE, NEED TO SELECT A FILE =========
 		if buttonFile.IsJustReleased() {
@@ -120,7 +292,23 @@ func (g *Game) Update() error {
 					musicPath = filename
 					pianoRollPath = ToPngPath(filename)
 					pianoRollExist = IsPngExist(pianoRollPath)
-					if pianoRollExist {
+					img, sf, err := LoadSpectrumImage(ToSpectrumPath(filename))
+					if err == nil {
+						// spectrum sidecar, drawn again from data
+						pianoRollExist = true
+						pianoRollImg = img
+						pianoRollImgHeight = img.Bounds().Dy()
+						rollSpectra, rollSpacing = sf.Spectra, sf.Spacing
+						SetChords(dft.DetectChords(dft.FirstChannel(sf.Spectra), sf.Spacing))
+						SetMusicKey(dft.DetectKey(dft.FirstChannel(sf.Spectra)))
+						SetBeats(dft.TrackBeats(dft.FirstChannel(sf.Spectra), sf.Spacing), sf.Spacing)
+						buttonAnalyse.SetActive(false)
+					} else if errors.Is(err, errAnalysisIncomplete) {
+						// png is half empty, analyse again to continue
+						pianoRollExist = false
+						infoMsg = "Analysis not finished, Analyse to continue."
+						buttonAnalyse.SetActive(true)
+					} else if pianoRollExist {
 						pianoRollImg = LoadPng(pianoRollPath)
 						pianoRollImgHeight = pianoRollImg.Bounds().Dy()
 						buttonAnalyse.SetActive(false)
@@ -156,7 +344,7 @@ func (g *Game) Update() error {
 		if ac.IsPlaying() && buttonPause.IsJustPressed() {
 			ac.Pause()
 		} else if ac.IsEnded() && buttonRewind.IsJustReleased() {
-			ac.player.Seek(time.Second * 0)
+			ac.Seek(time.Second * 0)
 		} else if !ac.IsPlaying() && buttonPlay.IsJustPressed() {
 			ac.Play()
 		}
@@ -168,19 +356,114 @@ func (g *Game) Update() error {
 			ac.Forward(time.Second * 5)
 		}
 
+		// ====== Speed =======
+		if buttonSpeed.IsJustReleased() {
+			// next slower speed, back to the first after the slowest
+			next := playbackSpeeds[0]
+			for _, s := range playbackSpeeds {
+				if s < ac.Speed()-speedStep/2 {
+					next = s
+					break
+				}
+			}
+			ac.SetSpeed(next)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyMinus) {
+			ac.SetSpeed(math.Max(minSpeed, ac.Speed()-speedStep))
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyEqual) {
+			ac.SetSpeed(math.Min(maxSpeed, ac.Speed()+speedStep))
+		}
+
+		// ====== Loop =======
+		// click on the roll set A then B, drag set both
+		if _, y := ebiten.CursorPosition(); inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && onRoll(y) {
+			dragging = true
+			dragFrom = yToTime(float64(y))
+		}
+		if dragging && inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+			dragging = false
+			_, y := ebiten.CursorPosition()
+			t := yToTime(float64(y))
+			if math.Abs(timeToY(dragFrom)-float64(y)) < 5 {
+				if _, _, ok := ac.Loop(); ok {
+					ac.ClearLoop()
+				}
+				if _, ok := ac.LoopA(); ok {
+					ac.SetLoopB(dragFrom)
+				} else {
+					ac.SetLoopA(dragFrom)
+				}
+			} else {
+				ac.ClearLoop()
+				ac.SetLoopA(dragFrom)
+				ac.SetLoopB(t)
+			}
+		}
+		// A, E keys set A and B at current time, C clear
+		if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+			ac.SetLoopA(ac.Current())
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+			ac.SetLoopB(ac.Current())
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+			ac.ClearLoop()
+		}
+
+		// ====== Transpose =======
+		if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) && transpose > -maxTranspose {
+			SetTranspose(transpose - 1)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) && transpose < maxTranspose {
+			SetTranspose(transpose + 1)
+		}
+
+		// ====== Reference MIDI =======
+		if buttonMidi.IsJustReleased() {
+			filename, err := dialog.File().Filter("MIDI file", "mid", "midi").Load()
+			if err != nil {
+				infoMsg = err.Error()
+			} else if spectra, err := LoadReference(filename, time.Millisecond*100, ac.Length()); err != nil {
+				infoMsg = err.Error()
+			} else {
+				refSpectra = spectra
+				DrawTransposed()
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+			refRollMode = (refRollMode + 1) % numRefMode
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyK) {
+			showScale = !showScale
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+			showBeats = !showBeats
+		}
+
 		// ====== Analysis =======
 		if buttonAnalyse.IsJustReleased() {
 			// analysis sound file
 			analysing = true
 			msg := make(chan string)
-			done := make(chan bool)
-			go AnalyseSound(musicPath, time.Millisecond*100, msg, done)
-			go UpdateAnalysisProgress(msg, done)
+			done := make(chan analysisResult)
+			var ctx context.Context
+			ctx, cancelAnalysis = context.WithCancel(context.Background())
+			analysisStopped = make(chan struct{})
+			go AnalyseSound(ctx, musicPath, time.Millisecond*100, msg, done)
+			go UpdateAnalysisProgress(msg, done, analysisResults, analysisStopped)
 			buttonAnalyse.SetActive(false)
-		}
-		// On going analysis
-		if analysing {
+		} else if analysing {
+			// on going analysis, not from the frame it started
 			infoMsg = fmt.Sprintf("Analysis Progress: %s", pianoRollImgProgress)
+			if buttonCancel.IsJustReleased() || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+				cancelAnalysis()
+			}
+			select {
+			case res := <-analysisResults:
+				applyAnalysis(res)
+			default:
+			}
 		}
 	}
 
@@ -207,6 +490,20 @@ func init() {
 	buttonAnalyse.SetText("Analyse", font18, color.Black)
 	buttonAnalyse.SetActive(false)
 
+	// own images, text is drawn on them, and clear of Analyse so the click
+	// starting analysis does not land on it
+	biC := ButtonImages(80, 30, bc)
+	buttonCancel = ui.NewButton(biC[0], biC[1], biC[2], biC[3], 470, 40)
+	buttonCancel.SetText("Cancel", font18, color.Black)
+
+	biM := ButtonImages(60, 30, bc)
+	buttonMidi = ui.NewButton(biM[0], biM[1], biM[2], biM[3], 120, 40)
+	buttonMidi.SetText("MIDI", font18, color.Black)
+
+	biS := ButtonImages(70, 30, bc)
+	buttonSpeed = ui.NewButton(biS[0], biS[1], biS[2], biS[3], 195, 40)
+	buttonSpeed.SetText("Speed", font18, color.Black)
+
 	imgPlay, _ := vfs.GetImage("assets/images/play_circle_FILL1_wght400_GRAD0_opsz48.png")
 	imgPause, _ := vfs.GetImage("assets/images/pause_circle_FILL1_wght400_GRAD0_opsz48.png")
 	imgBack, _ := vfs.GetImage("assets/images/replay_5_FILL1_wght400_GRAD0_opsz48.png")
@@ -220,6 +517,7 @@ func init() {
 	// buttonPause.SetActive(false)
 
 	pianoRollImgOp = &ebiten.DrawImageOptions{}
+	refRollImgOp = &ebiten.DrawImageOptions{}
 	// pianoRollImgOp.GeoM.Translate(0, 0)
 	// pianoRollImgOp.GeoM.Translate(0, pianoRollImgY)
 
@@ -230,10 +528,12 @@ func init() {
 	//                       30 height of message bar
 
 	analysing = false
+	analysisResults = make(chan analysisResult, 1)
 	game = &Game{}
 }
 
 func main() {
+	parseFlags()
 	icon, err := vfs.GetImage("assets/images/logo-universal.png")
 	if err != nil {
 		log.Println(err)
@@ -243,7 +543,9 @@ func main() {
 	ebiten.SetWindowIcon([]image.Image{icon})
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 
-	if err := ebiten.RunGame(game); err != nil {
+	ebiten.SetWindowClosingHandled(true)
+
+	if err := ebiten.RunGame(game); err != nil && err != errQuit {
 		panic(err)
 	}
 }
@@ -0,0 +1,314 @@
+// Package midi read and write Standard MIDI Files, format 0 and 1
+package midi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	StatusNoteOff = 0x80
+	StatusNoteOn  = 0x90
+	StatusMeta    = 0xFF
+	StatusSysEx   = 0xF0
+	StatusEscape  = 0xF7
+
+	MetaTrackName  = 0x03
+	MetaEndOfTrack = 0x2F
+	MetaTempo      = 0x51
+)
+
+type File struct {
+	Format   int // 0 single track, 1 tracks played together
+	Division int // ticks per quarter note
+	Tracks   []Track
+}
+
+type Track []Event
+
+// Event at an absolute time in ticks. Channel messages keep channel in
+// Status, Data is the data bytes. Meta events has Status 0xFF, type in Meta
+// and Data is the payload. SysEx keep the payload in Data.
+type Event struct {
+	Tick   int
+	Status byte
+	Meta   byte
+	Data   []byte
+}
+
+func NoteOn(tick int, channel, key, velocity byte) Event {
+	return Event{Tick: tick, Status: StatusNoteOn | channel&0x0F, Data: []byte{key, velocity}}
+}
+
+func NoteOff(tick int, channel, key byte) Event {
+	return Event{Tick: tick, Status: StatusNoteOff | channel&0x0F, Data: []byte{key, 0}}
+}
+
+// Tempo event, in beats per minute
+func Tempo(tick int, bpm float64) Event {
+	us := uint32(60e6/bpm + 0.5)
+	return Event{Tick: tick, Status: StatusMeta, Meta: MetaTempo,
+		Data: []byte{byte(us >> 16), byte(us >> 8), byte(us)}}
+}
+
+func TrackName(tick int, name string) Event {
+	return Event{Tick: tick, Status: StatusMeta, Meta: MetaTrackName, Data: []byte(name)}
+}
+
+// IsNoteOn is true for note on with velocity above 0
+func (e Event) IsNoteOn() bool {
+	return e.Status&0xF0 == StatusNoteOn && len(e.Data) == 2 && e.Data[1] > 0
+}
+
+// IsNoteOff is true for note off, and note on with velocity 0
+func (e Event) IsNoteOff() bool {
+	return e.Status&0xF0 == StatusNoteOff ||
+		(e.Status&0xF0 == StatusNoteOn && len(e.Data) == 2 && e.Data[1] == 0)
+}
+
+// Key and velocity of a note event
+func (e Event) Note() (key, velocity byte) {
+	if len(e.Data) < 2 {
+		return 0, 0
+	}
+	return e.Data[0], e.Data[1]
+}
+
+// BPM of a tempo event
+func (e Event) BPM() float64 {
+	if e.Status != StatusMeta || e.Meta != MetaTempo || len(e.Data) != 3 {
+		return 0
+	}
+	us := int(e.Data[0])<<16 | int(e.Data[1])<<8 | int(e.Data[2])
+	return 60e6 / float64(us)
+}
+
+// number of data bytes of channel messages
+func dataLen(status byte) int {
+	switch status & 0xF0 {
+	case 0xC0, 0xD0:
+		return 1
+	}
+	return 2
+}
+
+// Write encode f as a Standard MIDI File. Events of a track are sorted by
+// tick, end of track is added when missing.
+func Write(w io.Writer, f *File) error {
+	if f.Format != 0 && f.Format != 1 {
+		return fmt.Errorf("midi: unsupported format %d", f.Format)
+	}
+	if f.Format == 0 && len(f.Tracks) != 1 {
+		return fmt.Errorf("midi: format 0 need 1 track, got %d", len(f.Tracks))
+	}
+	if f.Division <= 0 || f.Division > 0x7FFF {
+		return fmt.Errorf("midi: division %d out of range", f.Division)
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("MThd")
+	binary.Write(bw, binary.BigEndian, uint32(6))
+	binary.Write(bw, binary.BigEndian, uint16(f.Format))
+	binary.Write(bw, binary.BigEndian, uint16(len(f.Tracks)))
+	binary.Write(bw, binary.BigEndian, uint16(f.Division))
+	for _, t := range f.Tracks {
+		data, err := encodeTrack(t)
+		if err != nil {
+			return err
+		}
+		bw.WriteString("MTrk")
+		binary.Write(bw, binary.BigEndian, uint32(len(data)))
+		bw.Write(data)
+	}
+	return bw.Flush()
+}
+
+func encodeTrack(t Track) ([]byte, error) {
+	events := make(Track, len(t))
+	copy(events, t)
+	sort.SliceStable(events, func(i, j int) bool {
+		// end of track stay last
+		if isEndOfTrack(events[i]) != isEndOfTrack(events[j]) {
+			return isEndOfTrack(events[j])
+		}
+		return events[i].Tick < events[j].Tick
+	})
+	if len(events) == 0 || !isEndOfTrack(events[len(events)-1]) {
+		tick := 0
+		if len(events) > 0 {
+			tick = events[len(events)-1].Tick
+		}
+		events = append(events, Event{Tick: tick, Status: StatusMeta, Meta: MetaEndOfTrack})
+	}
+
+	var buf bytes.Buffer
+	tick := 0
+	var running byte
+	for _, e := range events {
+		if e.Tick < tick {
+			// end of track before the last event
+			e.Tick = tick
+		}
+		writeVarLen(&buf, uint32(e.Tick-tick))
+		tick = e.Tick
+		switch {
+		case e.Status == StatusMeta:
+			buf.WriteByte(StatusMeta)
+			buf.WriteByte(e.Meta)
+			writeVarLen(&buf, uint32(len(e.Data)))
+			buf.Write(e.Data)
+			running = 0
+		case e.Status == StatusSysEx || e.Status == StatusEscape:
+			buf.WriteByte(e.Status)
+			writeVarLen(&buf, uint32(len(e.Data)))
+			buf.Write(e.Data)
+			running = 0
+		default:
+			size := dataLen(e.Status)
+			if len(e.Data) < size {
+				return nil, fmt.Errorf("midi: event %#x at tick %d need %d data bytes, got %d", e.Status, e.Tick, size, len(e.Data))
+			}
+			if e.Status != running {
+				buf.WriteByte(e.Status)
+				running = e.Status
+			}
+			buf.Write(e.Data[:size])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func isEndOfTrack(e Event) bool {
+	return e.Status == StatusMeta && e.Meta == MetaEndOfTrack
+}
+
+func writeVarLen(buf *bytes.Buffer, v uint32) {
+	b := []byte{byte(v & 0x7F)}
+	for v >>= 7; v > 0; v >>= 7 {
+		b = append([]byte{byte(v&0x7F) | 0x80}, b...)
+	}
+	buf.Write(b)
+}
+
+var errShort = errors.New("midi: unexpected end of data")
+
+// Read decode a Standard MIDI File, chunks other than tracks are skipped
+func Read(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return nil, errors.New("midi: not a MIDI file")
+	}
+	headerLen := int(binary.BigEndian.Uint32(data[4:8]))
+	if headerLen < 6 || 8+headerLen > len(data) {
+		return nil, errShort
+	}
+	f := &File{
+		Format:   int(binary.BigEndian.Uint16(data[8:10])),
+		Division: int(binary.BigEndian.Uint16(data[12:14])),
+	}
+	if f.Format > 1 {
+		return nil, fmt.Errorf("midi: unsupported format %d", f.Format)
+	}
+	if f.Division&0x8000 != 0 {
+		return nil, errors.New("midi: SMPTE time division not supported")
+	}
+	numTracks := int(binary.BigEndian.Uint16(data[10:12]))
+	data = data[8+headerLen:]
+	for len(f.Tracks) < numTracks && len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if 8+size > len(data) {
+			return nil, errShort
+		}
+		if id == "MTrk" {
+			t, err := decodeTrack(data[8 : 8+size])
+			if err != nil {
+				return nil, err
+			}
+			f.Tracks = append(f.Tracks, t)
+		}
+		data = data[8+size:]
+	}
+	if len(f.Tracks) != numTracks {
+		return nil, errShort
+	}
+	return f, nil
+}
+
+func decodeTrack(data []byte) (Track, error) {
+	t := Track{}
+	tick, i := 0, 0
+	var running byte
+	for i < len(data) {
+		delta, n := readVarLen(data[i:])
+		if n == 0 {
+			return nil, errShort
+		}
+		i += n
+		tick += int(delta)
+		if i >= len(data) {
+			return nil, errShort
+		}
+		status := data[i]
+		if status < 0x80 {
+			// running status, reuse last status
+			if running == 0 {
+				return nil, errors.New("midi: running status without status")
+			}
+			status = running
+		} else {
+			i++
+		}
+		e := Event{Tick: tick, Status: status}
+		switch {
+		case status == StatusMeta:
+			if i >= len(data) {
+				return nil, errShort
+			}
+			e.Meta = data[i]
+			i++
+			fallthrough
+		case status == StatusSysEx || status == StatusEscape:
+			size, n := readVarLen(data[i:])
+			if n == 0 || i+n+int(size) > len(data) {
+				return nil, errShort
+			}
+			i += n
+			e.Data = append([]byte{}, data[i:i+int(size)]...)
+			i += int(size)
+			running = 0
+		default:
+			size := dataLen(status)
+			if i+size > len(data) {
+				return nil, errShort
+			}
+			e.Data = append([]byte{}, data[i:i+size]...)
+			i += size
+			running = status
+		}
+		t = append(t, e)
+		if isEndOfTrack(e) {
+			break
+		}
+	}
+	return t, nil
+}
+
+// return value and number of bytes read, 0 bytes when data is too short
+func readVarLen(data []byte) (uint32, int) {
+	var v uint32
+	for i := 0; i < len(data) && i < 4; i++ {
+		v = v<<7 | uint32(data[i]&0x7F)
+		if data[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
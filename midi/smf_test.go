@@ -0,0 +1,101 @@
+package midi
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	notes := Track{
+		TrackName(0, "piano"),
+		NoteOn(0, 0, 60, 100),
+		NoteOn(0, 0, 64, 90),
+		NoteOff(480, 0, 60),
+		NoteOff(480, 0, 64),
+		NoteOn(480, 1, 67, 1),
+		NoteOff(100000, 1, 67),
+		{Tick: 100000, Status: StatusSysEx, Data: []byte{0x7E, 0x7F, 0x09, 0x01, 0xF7}},
+	}
+	tempo := Track{Tempo(0, 120), Tempo(960, 90)}
+	for _, f := range []*File{
+		{Format: 0, Division: 480, Tracks: []Track{append(append(Track{}, tempo...), notes...)}},
+		{Format: 1, Division: 96, Tracks: []Track{tempo, notes}},
+	} {
+		var buf bytes.Buffer
+		if err := Write(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Format != f.Format || got.Division != f.Division || len(got.Tracks) != len(f.Tracks) {
+			t.Fatalf("format %d: header want %d %d %d, got %d %d %d", f.Format,
+				f.Format, f.Division, len(f.Tracks), got.Format, got.Division, len(got.Tracks))
+		}
+		for i, track := range got.Tracks {
+			end := track[len(track)-1]
+			if !isEndOfTrack(end) {
+				t.Errorf("format %d track %d: missing end of track", f.Format, i)
+			}
+			want := sortedTrack(f.Tracks[i])
+			if !reflect.DeepEqual(track[:len(track)-1], want) {
+				t.Errorf("format %d track %d:\nwant %v\ngot  %v", f.Format, i, want, track)
+			}
+		}
+	}
+}
+
+// events in the order Write put them
+func sortedTrack(t Track) Track {
+	var buf bytes.Buffer
+	Write(&buf, &File{Format: 0, Division: 1, Tracks: []Track{t}})
+	f, _ := Read(&buf)
+	return f.Tracks[0][:len(f.Tracks[0])-1]
+}
+
+func TestRunningStatus(t *testing.T) {
+	f := &File{Format: 0, Division: 480, Tracks: []Track{{
+		NoteOn(0, 0, 60, 100), NoteOn(0, 0, 64, 100), NoteOn(10, 0, 60, 0),
+	}}}
+	var buf bytes.Buffer
+	Write(&buf, f)
+	// header 14, track header 8, 4 bytes first event, 3 bytes each after,
+	// end of track 4
+	if buf.Len() != 14+8+4+3+3+4 {
+		t.Errorf("running status not used, %d bytes", buf.Len())
+	}
+	got, _ := Read(&buf)
+	if !got.Tracks[0][2].IsNoteOff() {
+		t.Errorf("note on with velocity 0 should be note off")
+	}
+}
+
+func TestShortData(t *testing.T) {
+	f := &File{Format: 0, Division: 480, Tracks: []Track{{
+		{Tick: 0, Status: 0x90, Data: []byte{60}},
+	}}}
+	if err := Write(io.Discard, f); err == nil {
+		t.Errorf("note on with 1 data byte should fail")
+	}
+}
+
+func TestTempo(t *testing.T) {
+	if bpm := Tempo(0, 133).BPM(); math.Abs(bpm-133) > 0.001 {
+		t.Errorf("want 133 bpm, got %f", bpm)
+	}
+}
+
+func TestVarLen(t *testing.T) {
+	for _, v := range []uint32{0, 0x40, 0x7F, 0x80, 0x2000, 0x3FFF, 0x4000, 0x1FFFFF, 0x0FFFFFFF} {
+		var buf bytes.Buffer
+		writeVarLen(&buf, v)
+		got, n := readVarLen(buf.Bytes())
+		if got != v || n != buf.Len() {
+			t.Errorf("want %x, got %x in %d bytes", v, got, n)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"iatearock.com/musicroll/dft"
+)
+
+// Analysis settings, set from command line flags
+type AnalysisSettings struct {
+	Analyser   string // one of dft.AnalyserNames
+	Window     string // one of dft.WindowNames
+	KaiserBeta float64
+	Tuning     dft.Tuning
+	AutoTuning bool   // apply detected tuning offset before analysis
+	Salience   string // harmonic suppression, one of dft.PostProcessNames
+	MIDI       dft.MIDIOptions
+	Workers    int      // goroutines analysing in parallel
+	Channels   []string // from dft.ChannelNames
+	SplitRoll  bool     // channels side by side, instead of colour coded
+	HPSS       bool     // analyse harmonic part only, without drums
+}
+
+var settings AnalysisSettings
+
+func parseFlags() {
+	flag.StringVar(&settings.Analyser, "analyser", "goertzel",
+		fmt.Sprintf("spectral analyser, one of %s", strings.Join(dft.AnalyserNames, ", ")))
+	flag.StringVar(&settings.Window, "window", "rectangular",
+		fmt.Sprintf("window function, one of %s", strings.Join(dft.WindowNames, ", ")))
+	flag.Float64Var(&settings.KaiserBeta, "kaiser-beta", 8.6, "beta of kaiser window")
+	reference := flag.Float64("tuning-ref", 440, "frequency of A4 in Hz")
+	temperament := flag.String("temperament", "equal",
+		fmt.Sprintf("temperament, one of %s", strings.Join(dft.TemperamentNames, ", ")))
+	root := flag.String("temperament-root", "C", "pitch class the temperament is built on")
+	cents := flag.String("cents", "",
+		"custom temperament, 12 comma separated cents offsets from equal temperament, starting at the root")
+	flag.BoolVar(&settings.AutoTuning, "auto-tuning", false,
+		"detect how far the recording is from A440, and use that as tuning-ref")
+	flag.StringVar(&settings.Salience, "salience", "none",
+		fmt.Sprintf("harmonic suppression, one of %s", strings.Join(dft.PostProcessNames, ", ")))
+	flag.IntVar(&settings.MIDI.Format, "midi-format", dft.DefaultMIDIOptions.Format,
+		"format of exported MIDI file, 0 or 1")
+	flag.IntVar(&settings.MIDI.PPQ, "midi-ppq", dft.DefaultMIDIOptions.PPQ,
+		"ticks per quarter note of exported MIDI file")
+	flag.Float64Var(&settings.MIDI.Tempo, "midi-tempo", dft.DefaultMIDIOptions.Tempo,
+		"tempo of exported MIDI file, beats per minute")
+	flag.IntVar(&settings.Workers, "workers", runtime.GOMAXPROCS(0),
+		"number of windows analysed in parallel")
+	channels := flag.String("channels", "mix",
+		fmt.Sprintf("comma separated channels to analyse, from %s", strings.Join(dft.ChannelNames, ", ")))
+	flag.BoolVar(&settings.SplitRoll, "split-roll", false,
+		"draw channels side by side, instead of colour coded on one roll")
+	flag.BoolVar(&settings.HPSS, "hpss", false,
+		"separate harmonic from percussive content before analysis, slow")
+	flag.Parse()
+	if !contains(dft.AnalyserNames, settings.Analyser) {
+		log.Fatalf("unknown analyser %q", settings.Analyser)
+	}
+	if !contains(dft.WindowNames, settings.Window) {
+		log.Fatalf("unknown window %q", settings.Window)
+	}
+	if windowSet() && !dft.IsWindowed(settings.Analyser) {
+		log.Fatalf("analyser %s has its own window, -window and -kaiser-beta are not used", settings.Analyser)
+	}
+	if !contains(dft.PostProcessNames, settings.Salience) {
+		log.Fatalf("unknown salience %q", settings.Salience)
+	}
+	if settings.MIDI.Format != 0 && settings.MIDI.Format != 1 {
+		log.Fatalf("MIDI format must be 0 or 1, got %d", settings.MIDI.Format)
+	}
+	if settings.MIDI.PPQ <= 0 || settings.MIDI.PPQ > 0x7FFF || settings.MIDI.Tempo <= 0 {
+		log.Fatal("MIDI ppq and tempo must be positive")
+	}
+	if settings.Workers < 1 {
+		log.Fatalf("workers must be at least 1, got %d", settings.Workers)
+	}
+	for _, c := range strings.Split(*channels, ",") {
+		c = strings.TrimSpace(c)
+		if !contains(dft.ChannelNames, c) {
+			log.Fatalf("unknown channel %q", c)
+		}
+		settings.Channels = append(settings.Channels, c)
+	}
+	var err error
+	settings.Tuning, err = parseTuning(*reference, *temperament, *root, *cents)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTuning(reference float64, temperament, root, cents string) (dft.Tuning, error) {
+	pc, err := dft.PitchClass(root)
+	if err != nil {
+		return dft.Tuning{}, err
+	}
+	if cents == "" {
+		return dft.NewTuning(reference, temperament, pc)
+	}
+	var offsets [12]float64
+	fields := strings.Split(cents, ",")
+	if len(fields) != 12 {
+		return dft.Tuning{}, fmt.Errorf("want 12 cents offsets, got %d", len(fields))
+	}
+	for i, f := range fields {
+		offsets[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return dft.Tuning{}, err
+		}
+	}
+	return dft.CustomTuning(reference, pc, offsets), nil
+}
+
+// is a window flag given on command line
+func windowSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "window" || f.Name == "kaiser-beta" {
+			set = true
+		}
+	})
+	return set
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// apply settings to keys before analysis
+func applySettings(ctx context.Context, k *dft.Keys, sampleRate int) error {
+	a, err := dft.NewAnalyser(settings.Analyser, sampleRate, time.Millisecond*100)
+	if err != nil {
+		return err
+	}
+	tuning := settings.Tuning
+	tuningInfo = ""
+	if settings.AutoTuning {
+		cents, err := dft.EstimateTuning(ctx, k)
+		if err != nil {
+			return err
+		}
+		// cents are from A440, not from tuning-ref
+		tuning.Reference = dft.EqualTuning.Shift(cents).Reference
+		tuningInfo = fmt.Sprintf("Tuning: %+.1f cents (applied)", cents)
+	}
+	k.SetTuning(tuning)
+	k.SetAnalyser(a)
+	w, err := dft.NewWindow(settings.Window, settings.KaiserBeta)
+	if err != nil {
+		return err
+	}
+	k.SetWindow(w)
+	if err := k.SetSalience(settings.Salience); err != nil {
+		return err
+	}
+	k.SetSplit(settings.SplitRoll)
+	if settings.HPSS {
+		k.SetPreprocess(dft.NewHPSS(sampleRate))
+	}
+	return k.SetChannels(settings.Channels)
+}
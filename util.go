@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image/png"
 	"log"
@@ -10,30 +12,54 @@ import (
 	"strings"
 	"time"
 
-	"github.com/faiface/beep"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/vorbis"
-	"github.com/faiface/beep/wav"
 	"github.com/hajimehoshi/ebiten/v2"
+	"iatearock.com/musicroll/decoder"
 	"iatearock.com/musicroll/dft"
 )
 
-// is music file supported
+// is music file supported, by extension in any case, or by content
 func IsMusicFile(path string) bool {
-	suffix := []string{".mp3", ".ogg", ".wav"}
-	for _, s := range suffix {
-		if strings.HasSuffix(path, s) {
-			return true
-		}
-	}
-	return false
+	return decoder.Supported(path)
+}
+
+// path without extension, a file may have none
+func trimExt(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
 }
 
-// change path from mp3/wav/ogg to png
+// change path from mp3/wav/ogg/flac to png
 func ToPngPath(path string) string {
-	i := strings.LastIndex(path, ".")
-	return path[:i] + ".png"
+	return trimExt(path) + ".png"
+}
+
+// change path from mp3/wav/ogg to mid
+func ToMidPath(path string) string {
+	return trimExt(path) + ".mid"
+}
+
+// change path from mp3/wav/ogg to spectrum sidecar
+func ToSpectrumPath(path string) string {
+	return trimExt(path) + ".spectrum"
+}
+
+var errAnalysisIncomplete = errors.New("analysis not finished")
+
+// change path from mp3/wav/ogg to chord track
+func ToChordPath(path string) string {
+	return trimExt(path) + ".chords.csv"
+}
+
+// LoadSpectrumImage draw piano roll from a spectrum sidecar file, no need
+// to analyse again, the spectra are returned for chords
+func LoadSpectrumImage(path string) (*ebiten.Image, *dft.SpectrumFile, error) {
+	sf, err := dft.LoadSpectrum(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sf.Complete {
+		return nil, nil, errAnalysisIncomplete
+	}
+	return ebiten.NewImageFromImage(dft.DrawChannelSpectrum(sf.Spectra, 10, settings.SplitRoll)), sf, nil
 }
 
 func IsPngExist(path string) bool {
@@ -57,71 +83,211 @@ func LoadPng(path string) *ebiten.Image {
 	return ebiten.NewImageFromImage(img)
 }
 
-// Analyse sound, to be run in a go routine
-// use msg to pass message
-func AnalyseSound(path string, spacing time.Duration, msg chan string, done chan bool) {
-	var err error
-	f, err := os.Open(path)
-	// f, err := os.Open("/home/raymond/Music/Ed Sheeran - The Joker And The Queen [Official Lyric Video]-m9f4XtNj1Vg.mp3")
+// LoadReference turn notes of a MIDI file into spectra, with the same
+// spacing and length as the analysis, so both rolls scroll together
+func LoadReference(path string, spacing, length time.Duration) ([]map[string]float64, error) {
+	notes, err := dft.LoadMIDI(path)
 	if err != nil {
+		return nil, err
+	}
+	return dft.NotesToSpectra(notes, spacing, length), nil
+}
+
+// SetTranspose transpose playback by semitones, and the rolls to match
+func SetTranspose(semitones int) {
+	transpose = semitones
+	ac.SetSemitones(semitones)
+	if rollSpectra == nil && pianoRollImg != nil {
+		infoMsg = "No spectrum file, piano roll is not transposed."
+	}
+	if !analysing {
+		DrawTransposed()
+	}
+}
+
+// DrawTransposed draw rolls from spectra moved by transpose keys, chords
+// and key are detected again in the new key
+func DrawTransposed() {
+	if refSpectra != nil {
+		spectra := make([]map[string]float64, len(refSpectra))
+		for i, sp := range refSpectra {
+			spectra[i] = dft.TransposeSpectrum(sp, transpose)
+		}
+		refRollImg = ebiten.NewImageFromImage(dft.DrawSpectrum(spectra, 10))
+		refRollHeight = refRollImg.Bounds().Dy()
+	}
+	if rollSpectra == nil {
+		return
+	}
+	spectra := dft.TransposeSpectra(rollSpectra, transpose)
+	img := ebiten.NewImageFromImage(dft.DrawChannelSpectrum(spectra, 10, settings.SplitRoll))
+	// keep the height of the roll, the beat lines are drawn for it, time 0
+	// is at the bottom of both
+	roll := ebiten.NewImage(screenWidth, pianoRollImgHeight)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(0, float64(pianoRollImgHeight-img.Bounds().Dy()))
+	roll.DrawImage(img, op)
+	pianoRollImg = roll
+	SetChords(dft.DetectChords(dft.FirstChannel(spectra), rollSpacing))
+	SetMusicKey(dft.DetectKey(dft.FirstChannel(spectra)))
+}
+
+// SetChords set chords shown at the play time, from any goroutine
+func SetChords(c []dft.ChordEvent) {
+	chordsMu.Lock()
+	defer chordsMu.Unlock()
+	chords = c
+}
+
+// SetMusicKey show the key of the file, and its scale on the keyboard,
+// nothing when there is no key
+func SetMusicKey(m dft.MusicKey, ok bool) {
+	if !ok {
+		keyInfo, scaleImg = "", nil
 		return
 	}
-	defer f.Close()
-
-	ext := filepath.Ext(path)
-	// spacing:= time.Millisecond * 500
-	var format beep.Format
-	var streamer beep.StreamSeekCloser
-	var k *dft.Keys
-	switch ext {
-	case ".mp3":
-		streamer, format, err = mp3.Decode(f)
-	case ".wav":
-		streamer, format, err = wav.Decode(f)
-	case ".ogg":
-		streamer, format, err = vorbis.Decode(f)
-	case ".flac":
-		streamer, format, err = flac.Decode(f)
-	default:
+	keyInfo = "Key: " + m.String()
+	scaleImg = ebiten.NewImageFromImage(dft.DrawScale(m, 98))
+}
+
+// SetBeats show the tempo, and beat lines over the piano roll, nothing
+// when there is no tempo
+func SetBeats(grid dft.BeatGrid, spacing time.Duration) {
+	if grid.BPM == 0 {
+		// too short to tell, nothing from the file before
+		tempoInfo, beatImg = "", nil
 		return
 	}
+	tempoInfo = fmt.Sprintf("Tempo: %.0f bpm", grid.BPM)
+	img := dft.DrawBeatGrid(grid, spacing, pianoRollImgHeight/10, 10)
+	beatImg = ebiten.NewImageFromImage(img)
+}
+
+// openSpectrum continue the spectrum file of an analysis stopped half way,
+// when it is analysed with the same settings, otherwise start a new one
+func openSpectrum(k *dft.Keys, path string) (*dft.SpectrumWriter, error) {
+	sf := k.SpectrumFile()
+	if old, err := dft.LoadSpectrum(path); err == nil && !old.Complete && old.SameSettings(sf) {
+		if w, err := dft.OpenSpectrum(path); err == nil {
+			for i, sp := range old.Spectra {
+				k.AppendSpectrum(sp)
+				k.DrawStripe(sp, i)
+			}
+			return w, nil
+		}
+	}
+	return dft.CreateSpectrum(path, sf)
+}
+
+// analysisResult is what an analysis found, shown by applyAnalysis on the
+// UI thread, so the analysis goroutine does not write what Draw reads
+type analysisResult struct {
+	finished bool // false when stopped by ctx or an error
+	chords   []dft.ChordEvent
+	key      dft.MusicKey
+	keyOK    bool
+	beats    dft.BeatGrid
+	spectra  [][]map[string]float64
+	spacing  time.Duration
+}
+
+// Analyse sound, to be run in a go routine
+// use msg to pass message, done get the result when finished or stopped
+// by ctx or an error. Spectrum file is kept, to continue next time.
+func AnalyseSound(ctx context.Context, path string, spacing time.Duration, msg chan string, done chan analysisResult) {
+	res := analysisResult{spacing: spacing}
+	defer func() { done <- res }()
+	k, err := dft.OpenKeys(path)
 	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer k.Close()
+	if err := applySettings(ctx, k, k.SampleRate()); err != nil {
+		log.Println(err)
 		return
 	}
-	k = dft.NewKeys(format, streamer, path)
 	k.SetSpacing(spacing)
 	pianoRollImgHeight = k.GetImage().Bounds().Dy()
 	// pianoRollImgY = keyboardImgY - float64(pianoRollImgHeight)
 
-	pngPath := path[:strings.LastIndex(path, ".")] + ".png"
-	current := time.Millisecond * 0
-	count := 0
-	for current < k.Len() {
-
-		sp := k.Analyse(current)
-		k.DrawStripe(sp, count)
+	pngPath := ToPngPath(path)
+	sw, err := openSpectrum(k, ToSpectrumPath(path))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer sw.Close()
+	// resume after frames already in spectrum file
+	numFrame := k.NumFrames()
+	err = k.AnalyseParallel(ctx, sw.Frames(), settings.Workers, func(i int, sp []map[string]float64) error {
+		k.AppendSpectrum(sp)
+		k.DrawStripe(sp, i)
+		if err := sw.Append(sp); err != nil {
+			log.Printf("save spectrum : %v", err)
+		}
 		// update image
 		pianoRollImg = ebiten.NewImageFromImage(k.GetImage())
-		current += k.Spacing()
-		count += 1
-		msg <- fmt.Sprintf("%0.2f", current.Seconds()/k.Len().Seconds())
-		if count%10 == 0 {
+		msg <- fmt.Sprintf("%0.2f", float64(i+1)/float64(numFrame))
+		if (i+1)%10 == 0 {
 			k.SaveImage(pngPath)
 		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("analysis stopped : %v", err)
+		return
 	}
 	k.SaveImage(pngPath)
-	done <- true
+	if err := sw.Complete(); err != nil {
+		log.Printf("save spectrum : %v", err)
+	}
+	if err := k.SaveMIDI(ToMidPath(path), dft.DefaultSegmentOptions, settings.MIDI); err != nil {
+		log.Printf("export midi : %v", err)
+	}
+	res.chords = k.Chords()
+	res.key, res.keyOK = k.MusicKey()
+	res.beats = k.Beats()
+	res.spectra = k.GetSpectrum(0)
+	if err := k.SaveChords(ToChordPath(path)); err != nil {
+		log.Printf("export chords : %v", err)
+	}
+	res.finished = true
 }
 
-func UpdateAnalysisProgress(msg chan string, done chan bool) {
+// UpdateAnalysisProgress show progress of an analysis, and pass its result
+// on to results, stopped is closed after that
+func UpdateAnalysisProgress(msg chan string, done chan analysisResult, results chan analysisResult, stopped chan struct{}) {
+	defer close(stopped)
 	for {
 		select {
 		case m := <-msg:
 			pianoRollImgProgress = m
-		case <-done:
-			analysing = false
-			pianoRollImgProgress = "Completed"
+		case res := <-done:
+			results <- res
 			return
 		}
 	}
 }
+
+// applyAnalysis show the result of an analysis, called from Update
+func applyAnalysis(res analysisResult) {
+	analysing = false
+	if !res.finished {
+		// show Analyse button again, to continue
+		pianoRollImgProgress = "Stopped"
+		infoMsg = "Analysis stopped, Analyse to continue."
+		pianoRollImg = nil
+		buttonAnalyse.SetActive(true)
+		return
+	}
+	pianoRollImgProgress = "Completed"
+	infoMsg = fmt.Sprintf("Analysis Progress: %s", pianoRollImgProgress)
+	SetChords(res.chords)
+	SetMusicKey(res.key, res.keyOK)
+	SetBeats(res.beats, res.spacing)
+	rollSpectra, rollSpacing = res.spectra, res.spacing
+	if transpose != 0 {
+		DrawTransposed()
+	}
+}